@@ -1,10 +1,15 @@
 package main
 
 import (
+	"compress/flate"
 	"context"
+	"go-websocket/internal/admin"
 	"go-websocket/internal/auth"
 	"go-websocket/internal/config"
 	"go-websocket/internal/logger"
+	"go-websocket/internal/metrics"
+	"go-websocket/internal/persistence"
+	"go-websocket/internal/ratelimit"
 	"go-websocket/internal/redis"
 	"go-websocket/internal/ws"
 	"log/slog"
@@ -32,9 +37,140 @@ func main() {
 	redisClient := redis.NewClient(cfg.RedisURL)
 	defer redisClient.Close()
 
+	payloadFormat := redis.PayloadFormat(cfg.RedisPayloadFormat)
+	switch payloadFormat {
+	case redis.PayloadJSON, redis.PayloadProtobuf:
+		redisClient.SetPayloadFormat(payloadFormat)
+	default:
+		slog.Error("Invalid REDIS_PAYLOAD_FORMAT", "format", cfg.RedisPayloadFormat)
+		os.Exit(1)
+	}
+
+	if cfg.HistoryMaxEvents < 0 || cfg.HistoryTTL < 0 {
+		slog.Error("Invalid HISTORY_MAX_EVENTS or HISTORY_TTL", "events", cfg.HistoryMaxEvents, "ttl", cfg.HistoryTTL)
+		os.Exit(1)
+	}
+	redisClient.SetHistory(cfg.HistoryMaxEvents, time.Duration(cfg.HistoryTTL)*time.Second)
+
+	// Rate limits
+	connRules, err := ratelimit.ParseRules(cfg.RateLimitConnRules)
+	if err != nil {
+		slog.Error("Invalid RATE_LIMIT_CONN_RULES", "error", err)
+		os.Exit(1)
+	}
+
+	userRules, err := ratelimit.ParseRules(cfg.RateLimitUserRules)
+	if err != nil {
+		slog.Error("Invalid RATE_LIMIT_USER_RULES", "error", err)
+		os.Exit(1)
+	}
+
+	rateLimitAction := ws.RateLimitAction(cfg.RateLimitAction)
+	switch rateLimitAction {
+	case ws.RateLimitDrop, ws.RateLimitError, ws.RateLimitClose:
+	default:
+		slog.Error("Invalid RATE_LIMIT_ACTION", "action", cfg.RateLimitAction)
+		os.Exit(1)
+	}
+
+	trustedProxies, err := ws.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		slog.Error("Invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+
+	if cfg.CompressionLevel < flate.HuffmanOnly || cfg.CompressionLevel > flate.BestCompression {
+		slog.Error("Invalid COMPRESSION_LEVEL", "level", cfg.CompressionLevel)
+		os.Exit(1)
+	}
+
+	backpressurePolicy := ws.BackpressurePolicy(cfg.BackpressurePolicy)
+	if !ws.ValidBackpressurePolicy(backpressurePolicy) {
+		slog.Error("Invalid BACKPRESSURE_POLICY", "policy", cfg.BackpressurePolicy)
+		os.Exit(1)
+	}
+
+	backpressureRules, err := ws.ParseBackpressureRules(cfg.BackpressureRules)
+	if err != nil {
+		slog.Error("Invalid BACKPRESSURE_RULES", "error", err)
+		os.Exit(1)
+	}
+
+	transportMode := ws.TransportMode(cfg.TransportMode)
+	if !ws.ValidTransportMode(transportMode) {
+		slog.Error("Invalid TRANSPORT_MODE", "mode", cfg.TransportMode)
+		os.Exit(1)
+	}
+
+	// Persistence of client-originated messages
+	var messageStore ws.MessageStore
+	switch cfg.MessageStore {
+	case "":
+	case "webhook":
+		if cfg.MessageWebhookURL == "" {
+			slog.Error("MESSAGE_WEBHOOK_URL is required when MESSAGE_STORE=webhook")
+			os.Exit(1)
+		}
+		messageStore = persistence.NewWebhookStore(cfg.MessageWebhookURL, cfg.MessageWebhookSecret, time.Duration(cfg.MessageWebhookTimeout)*time.Second)
+	case "stream":
+		messageStore = redis.NewStreamStore(redisClient, cfg.MessageStreamKey, int64(cfg.MessageStreamMaxLen))
+	default:
+		slog.Error("Invalid MESSAGE_STORE", "store", cfg.MessageStore)
+		os.Exit(1)
+	}
+
 	// Create hub
-	hub := ws.NewHub(redisClient)
-	go hub.Run()
+	hub := ws.NewHub(redisClient, ws.Options{
+		NodeId: cfg.NodeId,
+		RateLimit: ws.RateLimitOptions{
+			ConnRules:  connRules,
+			UserRules:  userRules,
+			Action:     rateLimitAction,
+			CloseAfter: cfg.RateLimitCloseAfter,
+		},
+		Admission: ws.AdmissionOptions{
+			MaxConnsPerUser: cfg.MaxConnsPerUser,
+			MaxConnsPerIP:   cfg.MaxConnsPerIP,
+			MaxConnsPerNode: cfg.MaxConnsPerNode,
+			TrustedProxies:  trustedProxies,
+			RetryAfter:      time.Duration(cfg.RetryAfterSeconds) * time.Second,
+		},
+		Messages: ws.MessageOptions{
+			Store:            messageStore,
+			MaxContentLength: cfg.MessageMaxLength,
+		},
+		Receipts: ws.ReceiptOptions{
+			AuthorOnly: cfg.ReadReceiptsAuthorOnly,
+		},
+		Whisper: ws.WhisperOptions{
+			MaxSize: cfg.WhisperMaxSize,
+		},
+		Heartbeat: ws.HeartbeatOptions{
+			AppInterval: time.Duration(cfg.AppHeartbeatInterval) * time.Second,
+		},
+		Compression: ws.CompressionOptions{
+			Enabled: cfg.CompressionEnabled,
+			Level:   cfg.CompressionLevel,
+			MinSize: cfg.CompressionMinSize,
+		},
+		Coalesce: ws.CoalesceOptions{
+			MaxFrames: cfg.WriteCoalesceMaxFrames,
+		},
+		Backpressure: ws.BackpressureOptions{
+			Default: backpressurePolicy,
+			Rules:   backpressureRules,
+		},
+		Buckets: ws.BucketOptions{
+			Count:     cfg.HubBuckets,
+			QueueSize: cfg.HubBucketQueueSize,
+		},
+		Replay: ws.ReplayOptions{
+			MaxEvents: cfg.ReplayMaxEvents,
+		},
+		Transport: ws.TransportOptions{
+			Mode: transportMode,
+		},
+	})
 
 	// Subscribe to Redis
 	go redis.SubscribeToEvents(redisClient, hub)
@@ -49,6 +185,12 @@ func main() {
 		w.Write([]byte("OK"))
 	})
 
+	http.Handle("/metrics", metrics.Handler())
+
+	if cfg.AdminToken != "" {
+		http.Handle("/admin/", admin.Handler(hub, cfg.AdminToken))
+	}
+
 	server := &http.Server{
 		Addr: ":" + cfg.Port,
 	}
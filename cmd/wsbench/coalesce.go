@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-websocket/internal/ws"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runCoalesce publishes events to a channel at a fixed rate and compares the
+// network writes and CPU time per delivered frame with and without write
+// coalescing
+func runCoalesce(args []string) error {
+	fs := flag.NewFlagSet("coalesce", flag.ExitOnError)
+	clients := fs.Int("clients", 10, "connections in the channel")
+	rate := fs.Int("rate", 10000, "events published per second")
+	duration := fs.Duration("duration", 5*time.Second, "how long to publish")
+	size := fs.Int("size", 256, "approximate event size in bytes")
+	maxFrames := fs.Int("max-frames", 64, "CoalesceOptions.MaxFrames of the coalescing run")
+	fs.Parse(args)
+
+	fmt.Printf("clients=%d rate=%d/s duration=%v size=%d\n", *clients, *rate, *duration, *size)
+	fmt.Printf("%-12s %12s %14s %16s %14s\n", "max-frames", "frames", "writes/frame", "cpu/frame", "delivered/s")
+
+	for _, frames := range []int{1, *maxFrames} {
+		if err := coalesceRun(*clients, *rate, *duration, *size, frames); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func coalesceRun(clients, rate int, duration time.Duration, size, maxFrames int) error {
+	srv, err := newServer(ws.Options{
+		NodeId:   "bench",
+		Coalesce: ws.CoalesceOptions{MaxFrames: maxFrames},
+	})
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	const channelId = "channel_bench"
+
+	var received atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		conn, err := srv.dial(fmt.Sprintf("user_%d", i), channelId)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		// Skip the welcome frame
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+				received.Add(1)
+			}
+		}()
+	}
+
+	// Publish in 1ms ticks, the way bursts arrive from Redis
+	perTick := rate / 1000
+	if perTick < 1 {
+		perTick = 1
+	}
+	payload := messageCreated(0, size)
+
+	before := readUsage()
+	start := time.Now()
+	ticker := time.NewTicker(time.Millisecond)
+	published := 0
+	for time.Since(start) < duration {
+		<-ticker.C
+		for i := 0; i < perTick; i++ {
+			srv.publish(channelId, payload)
+		}
+		published += perTick
+	}
+	ticker.Stop()
+
+	expected := int64(published * clients)
+	deadline := time.Now().Add(10 * time.Second)
+	for received.Load() < expected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	elapsed := time.Since(start)
+	after := readUsage()
+
+	frames := received.Load()
+	writes := "n/a"
+	if before.writes >= 0 {
+		writes = fmt.Sprintf("%.3f", float64(after.writes-before.writes)/float64(frames))
+	}
+	cpu := "n/a"
+	if after.cpu > 0 {
+		cpu = ((after.cpu - before.cpu) / time.Duration(frames)).String()
+	}
+
+	fmt.Printf("%-12d %12d %14s %16s %14.0f\n", maxFrames, frames, writes, cpu, float64(frames)/elapsed.Seconds())
+	return nil
+}
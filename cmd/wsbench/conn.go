@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// discardConn is a network connection that accepts every write, so the
+// benchmarks measure framing and compression rather than the network
+type discardConn struct{}
+
+func (discardConn) Read(p []byte) (int, error)         { return 0, io.EOF }
+func (discardConn) Write(p []byte) (int, error)        { return len(p), nil }
+func (discardConn) Close() error                       { return nil }
+func (discardConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (discardConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (discardConn) SetDeadline(t time.Time) error      { return nil }
+func (discardConn) SetReadDeadline(t time.Time) error  { return nil }
+func (discardConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// hijacker hands the upgrader a discardConn
+type hijacker struct {
+	http.ResponseWriter
+}
+
+func (hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn := discardConn{}
+	return conn, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), nil
+}
+
+// newServerConn upgrades a fake request the way the server does, optionally
+// negotiating permessage-deflate
+func newServerConn(compress bool, level int) (*websocket.Conn, error) {
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if compress {
+		r.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate")
+	}
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		EnableCompression: compress,
+	}
+	conn, err := upgrader.Upgrade(hijacker{httptest.NewRecorder()}, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	if compress {
+		if err := conn.SetCompressionLevel(level); err != nil {
+			return nil, err
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+)
+
+// runFanout compares writing one event to every connection of a channel with
+// a frame per connection, as WritePump did before prepared messages, against
+// a prepared message shared by all connections
+func runFanout(args []string) error {
+	fs := flag.NewFlagSet("fanout", flag.ExitOnError)
+	conns := fs.Int("conns", 5000, "connections in the channel")
+	events := fs.Int("events", 100, "events to fan out")
+	size := fs.Int("size", 2048, "approximate event size in bytes")
+	compress := fs.Bool("compress", false, "negotiate permessage-deflate")
+	level := fs.Int("level", 1, "deflate level")
+	fs.Parse(args)
+
+	clients := make([]*websocket.Conn, *conns)
+	for i := range clients {
+		conn, err := newServerConn(*compress, *level)
+		if err != nil {
+			return err
+		}
+		clients[i] = conn
+	}
+
+	payloads := make([][]byte, *events)
+	for i := range payloads {
+		payloads[i] = messageCreated(i, *size)
+	}
+
+	modes := []struct {
+		name   string
+		fanOut func(payload []byte) error
+	}{
+		{"per-connection", func(payload []byte) error {
+			for _, conn := range clients {
+				w, err := conn.NextWriter(websocket.TextMessage)
+				if err != nil {
+					return err
+				}
+				w.Write(payload)
+				if err := w.Close(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"prepared", func(payload []byte) error {
+			prepared, err := websocket.NewPreparedMessage(websocket.TextMessage, payload)
+			if err != nil {
+				return err
+			}
+			for _, conn := range clients {
+				if err := conn.WritePreparedMessage(prepared); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	}
+
+	fmt.Printf("conns=%d events=%d size=%d compress=%v level=%d\n", *conns, *events, len(payloads[0]), *compress, *level)
+	fmt.Printf("%-16s %14s %14s %16s %14s\n", "mode", "cpu/fan-out", "cpu/conn", "allocs/fan-out", "bytes/fan-out")
+
+	for _, mode := range modes {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		// Writes run on this goroutine only, so wall time is CPU time
+		start := time.Now()
+		for _, payload := range payloads {
+			if err := mode.fanOut(payload); err != nil {
+				return err
+			}
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		perFanOut := elapsed / time.Duration(*events)
+		fmt.Printf("%-16s %14v %14v %16d %14d\n",
+			mode.name,
+			perFanOut,
+			perFanOut/time.Duration(*conns),
+			(after.Mallocs-before.Mallocs)/uint64(*events),
+			(after.TotalAlloc-before.TotalAlloc)/uint64(*events),
+		)
+	}
+	return nil
+}
+
+// messageCreated builds a message:created event of roughly size bytes
+func messageCreated(i, size int) []byte {
+	words := []string{"the", "release", "is", "ready", "for", "review", "and", "deploy", "tomorrow", "morning"}
+	var content strings.Builder
+	for j := 0; content.Len() < size; j++ {
+		content.WriteString(words[(i+j*7)%len(words)])
+		content.WriteByte(' ')
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":      "message:created",
+		"channelId": "channel_bench",
+		"timestamp": time.Now().Unix(),
+		"data": map[string]interface{}{
+			"id":         fmt.Sprintf("msg_%d", i),
+			"content":    content.String(),
+			"authorId":   "user_bench",
+			"authorName": "Bench",
+			"createdAt":  time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+	return payload
+}
@@ -0,0 +1,38 @@
+// Command wsbench measures the cost of the server's WebSocket hot paths.
+//
+//	go run ./cmd/wsbench fanout -conns 5000 -size 2048 -compress
+//	go run ./cmd/wsbench coalesce -clients 10 -rate 10000
+//	go run -race ./cmd/wsbench stress
+//	go run ./cmd/wsbench storm -rate 50000
+//	go run ./cmd/wsbench memory -conns 10000
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+var benchmarks = map[string]func(args []string) error{
+	"fanout":   runFanout,
+	"coalesce": runCoalesce,
+	"stress":   runStress,
+	"storm":    runStorm,
+	"memory":   runMemory,
+}
+
+func main() {
+	if len(os.Args) < 2 || benchmarks[os.Args[1]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: wsbench <benchmark> [flags]")
+		fmt.Fprintln(os.Stderr, "benchmarks: fanout, coalesce, stress, storm, memory")
+		os.Exit(2)
+	}
+
+	// Keep the server's per-connection logs out of the results
+	slog.SetLogLoggerLevel(slog.LevelWarn)
+
+	if err := benchmarks[os.Args[1]](os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "wsbench:", err)
+		os.Exit(1)
+	}
+}
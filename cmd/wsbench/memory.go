@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"go-websocket/internal/ws"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// runMemory measures what an idle connection costs the server, for each
+// transport. The clients are held by a child process so that only the
+// server's memory is counted:
+//
+//	go run ./cmd/wsbench memory -conns 10000
+//	go run ./cmd/wsbench memory -conns 10000 -transports goroutines -pool=false
+func runMemory(args []string) error {
+	fs := flag.NewFlagSet("memory", flag.ExitOnError)
+	conns := fs.Int("conns", 10000, "idle connections to open")
+	transports := fs.String("transports", "goroutines,epoll", "comma separated transports to measure")
+	pool := fs.Bool("pool", true, "take write buffers from a shared pool; -pool=false gives each connection its own")
+	dial := fs.String("dial", "", "hold connections to this URL until stdin closes (used by the child process)")
+	fs.Parse(args)
+
+	if *dial != "" {
+		return holdConnections(*dial, *conns)
+	}
+
+	fmt.Printf("pool=%v\n", *pool)
+	fmt.Printf("%-12s %8s %12s %12s %12s %16s\n", "transport", "conns", "heap/conn", "stack/conn", "total/conn", "goroutines/conn")
+	for _, transport := range strings.Split(*transports, ",") {
+		opts := ws.TransportOptions{Mode: ws.TransportMode(transport), DedicatedWriteBuffers: !*pool}
+		if err := measureIdle(opts, *conns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Signed, as the heap can shrink between two snapshots
+type memSnapshot struct {
+	heap       int64
+	stack      int64
+	goroutines int
+}
+
+func readMem() memSnapshot {
+	// Twice, so pooled buffers are freed too
+	runtime.GC()
+	runtime.GC()
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return memSnapshot{heap: int64(m.HeapAlloc), stack: int64(m.StackInuse), goroutines: runtime.NumGoroutine()}
+}
+
+func measureIdle(opts ws.TransportOptions, conns int) error {
+	srv, err := newServer(ws.Options{NodeId: "bench", Transport: opts})
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	token, err := srv.issuer.token("idle")
+	if err != nil {
+		return err
+	}
+	url := "ws" + strings.TrimPrefix(srv.http.URL, "http") + "/ws?token=" + token
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	before := readMem()
+
+	child := exec.Command(exe, "memory", "-conns", strconv.Itoa(conns), "-dial", url)
+	child.Stderr = os.Stderr
+	stdin, err := child.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := child.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := child.Start(); err != nil {
+		return err
+	}
+	defer child.Wait()
+	defer stdin.Close()
+
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "ready\n" {
+		return fmt.Errorf("client process failed: %q %v", line, err)
+	}
+	if !waitConnections(srv, conns) {
+		return fmt.Errorf("%s: %d of %d connections registered", opts.Mode, len(srv.hub.Connections()), conns)
+	}
+
+	// Let the welcome frames go out and their writers exit
+	time.Sleep(2 * time.Second)
+	after := readMem()
+
+	heap := float64(after.heap-before.heap) / float64(conns)
+	stack := float64(after.stack-before.stack) / float64(conns)
+	fmt.Printf("%-12s %8d %11.0fB %11.0fB %11.0fB %16.2f\n", opts.Mode, conns, heap, stack, heap+stack,
+		float64(after.goroutines-before.goroutines)/float64(conns))
+
+	// Wait for the server to let go of the connections before the next run
+	stdin.Close()
+	child.Wait()
+	if !waitConnections(srv, 0) {
+		return fmt.Errorf("%s: %d connections still registered", opts.Mode, len(srv.hub.Connections()))
+	}
+	return nil
+}
+
+func waitConnections(srv *server, n int) bool {
+	deadline := time.Now().Add(60 * time.Second)
+	for len(srv.hub.Connections()) != n {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// holdConnections opens idle connections spread over 100 channels, reports
+// "ready" on stdout and keeps them open until stdin is closed
+func holdConnections(url string, conns int) error {
+	dialer := websocket.Dialer{ReadBufferSize: 256, WriteBufferSize: 256, HandshakeTimeout: 10 * time.Second}
+
+	held := make([]*websocket.Conn, 0, conns)
+	for i := 0; i < conns; i++ {
+		conn, _, err := dialer.Dial(fmt.Sprintf("%s&channelId=idle_%d", url, i%100), nil)
+		if err != nil {
+			return fmt.Errorf("connection %d: %w", i, err)
+		}
+		held = append(held, conn)
+	}
+	fmt.Println("ready")
+
+	if _, err := io.Copy(io.Discard, os.Stdin); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	for _, conn := range held {
+		conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"go-websocket/internal/auth"
+	"go-websocket/internal/models"
+	"go-websocket/internal/ws"
+	"go-websocket/internal/ws/wstest"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// issuer signs tokens accepted by the auth package, through a local JWKS
+type issuer struct {
+	key *rsa.PrivateKey
+	url string
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+var (
+	testIssuer     *issuer
+	testIssuerOnce sync.Once
+	testIssuerErr  error
+)
+
+// setupAuth points the auth package at a local issuer, once per process
+func setupAuth() (*issuer, error) {
+	testIssuerOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			testIssuerErr = err
+			return
+		}
+
+		jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+			e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+			fmt.Fprintf(w, `{"keys":[{"kid":"bench","kty":"RSA","use":"sig","alg":"RS256","n":"%s","e":"%s"}]}`, n, e)
+		}))
+
+		testIssuer = &issuer{key: key, url: jwks.URL, tokens: map[string]string{}}
+		testIssuerErr = auth.InitJWKS(jwks.URL)
+	})
+	return testIssuer, testIssuerErr
+}
+
+// token returns a signed token for a user, cached since signing is slow
+func (i *issuer) token(userId string) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if token, ok := i.tokens[userId]; ok {
+		return token, nil
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub":        userId,
+		"iss":        i.url,
+		"given_name": userId,
+		"exp":        time.Now().Add(24 * time.Hour).Unix(),
+	})
+	t.Header["kid"] = "bench"
+
+	token, err := t.SignedString(i.key)
+	if err != nil {
+		return "", err
+	}
+	i.tokens[userId] = token
+	return token, nil
+}
+
+// server is an in-process WebSocket server without Redis
+type server struct {
+	hub    *ws.Hub
+	http   *httptest.Server
+	issuer *issuer
+}
+
+func newServer(opts ws.Options) (*server, error) {
+	return newServerWith(wstest.NopPublisher{}, opts)
+}
+
+func newServerWith(publisher ws.RedisPublisher, opts ws.Options) (*server, error) {
+	iss, err := setupAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	hub := ws.NewHub(publisher, opts)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.ServeWS(hub, w, r)
+	}))
+	return &server{hub: hub, http: srv, issuer: iss}, nil
+}
+
+func (s *server) Close() {
+	s.http.CloseClientConnections()
+	s.http.Close()
+}
+
+func (s *server) dial(userId, channelId string) (*websocket.Conn, error) {
+	token, err := s.issuer.token(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	url := "ws" + strings.TrimPrefix(s.http.URL, "http") + "/ws?channelId=" + channelId + "&token=" + token
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	return conn, err
+}
+
+// publish injects an event as if it had been received from Redis
+func (s *server) publish(channelId string, payload []byte) {
+	s.hub.Broadcast(&models.BroadcastMessage{ChannelId: channelId, Payload: payload})
+}
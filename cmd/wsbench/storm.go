@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-websocket/internal/ws"
+	"go-websocket/internal/ws/wstest"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// redisLatency makes the Redis calls of connects and disconnects take as long
+// as a round trip to Redis would
+type redisLatency struct {
+	wstest.NopPublisher
+	delay time.Duration
+}
+
+func (p redisLatency) AddChannelMember(channelId, userId string) error {
+	time.Sleep(p.delay)
+	return nil
+}
+
+func (p redisLatency) PublishPresenceJoin(channelId, userId, userName string) error {
+	time.Sleep(p.delay)
+	return nil
+}
+
+func (p redisLatency) PublishPresenceLeave(channelId, userId string) error {
+	time.Sleep(p.delay)
+	return nil
+}
+
+// runStorm publishes events at a fixed rate, the way the Redis subscriber
+// does, while connections are opened and closed as fast as possible. It
+// reports how long connects and publishes take and how many events arrive.
+func runStorm(args []string) error {
+	fs := flag.NewFlagSet("storm", flag.ExitOnError)
+	duration := fs.Duration("duration", 5*time.Second, "how long to run")
+	channels := fs.Int("channels", 16, "channels receiving events")
+	subscribers := fs.Int("subscribers", 20, "connections reading each channel")
+	rate := fs.Int("rate", 20000, "events published per second")
+	size := fs.Int("size", 512, "approximate event size in bytes")
+	stormers := fs.Int("stormers", 32, "goroutines connecting and disconnecting in a loop")
+	latency := fs.Duration("redis-latency", 500*time.Microsecond, "simulated Redis round trip of connects and disconnects")
+	fs.Parse(args)
+
+	// Stormers hang up in the middle of broadcasts, which the server logs as
+	// failed writes
+	slog.SetLogLoggerLevel(slog.LevelError + 1)
+
+	srv, err := newServerWith(redisLatency{delay: *latency}, ws.Options{NodeId: "bench"})
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	channelId := func(i int) string { return fmt.Sprintf("channel_%d", i%*channels) }
+
+	var received atomic.Int64
+	var readers sync.WaitGroup
+	for i := 0; i < *channels**subscribers; i++ {
+		conn, err := srv.dial(fmt.Sprintf("subscriber_%d", i), channelId(i))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+				received.Add(1)
+			}
+		}()
+	}
+
+	// Count only what is published from here on
+	time.Sleep(500 * time.Millisecond)
+	received.Store(0)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Stormers
+	var connectMu sync.Mutex
+	var connects []time.Duration
+	var connectErrors atomic.Int64
+	for g := 0; g < *stormers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			var local []time.Duration
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					connectMu.Lock()
+					connects = append(connects, local...)
+					connectMu.Unlock()
+					return
+				default:
+				}
+
+				start := time.Now()
+				conn, err := srv.dial(fmt.Sprintf("stormer_%d", g), channelId(g+i))
+				if err != nil {
+					connectErrors.Add(1)
+					continue
+				}
+				// The welcome frame is queued on register
+				_, _, err = conn.ReadMessage()
+				if err != nil {
+					connectErrors.Add(1)
+				} else {
+					local = append(local, time.Since(start))
+				}
+				conn.Close()
+			}
+		}(g)
+	}
+
+	// Publisher, timing each hand-off to the hub
+	perTick := max(*rate/1000, 1)
+	payload := messageCreated(0, *size)
+	var publishes []time.Duration
+	start := time.Now()
+	ticker := time.NewTicker(time.Millisecond)
+	for time.Since(start) < *duration {
+		<-ticker.C
+		for i := 0; i < perTick; i++ {
+			t := time.Now()
+			srv.publish(channelId(len(publishes)), payload)
+			publishes = append(publishes, time.Since(t))
+		}
+	}
+	ticker.Stop()
+	elapsed := time.Since(start)
+
+	close(stop)
+	wg.Wait()
+
+	// Let the subscribers catch up
+	expected := int64(len(publishes) * *subscribers)
+	deadline := time.Now().Add(5 * time.Second)
+	for received.Load() < expected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	slices.Sort(connects)
+	slices.Sort(publishes)
+	fmt.Printf("connections=%d stormers=%d rate=%d/s redis-latency=%v\n", *channels**subscribers, *stormers, *rate, *latency)
+	fmt.Printf("connects:  %8.0f/s  p50 %-10v p99 %-10v errors %d\n",
+		float64(len(connects))/elapsed.Seconds(), percentile(connects, 50), percentile(connects, 99), connectErrors.Load())
+	fmt.Printf("publishes: %8.0f/s  p50 %-10v p99 %-10v max %v\n",
+		float64(len(publishes))/elapsed.Seconds(), percentile(publishes, 50), percentile(publishes, 99), percentile(publishes, 100))
+	fmt.Printf("delivered: %.1f%% of %d frames\n", 100*float64(received.Load())/float64(expected), expected)
+	return nil
+}
+
+// percentile returns the p-th percentile of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*p/100]
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go-websocket/internal/ws"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// runStress races broadcasts against connects, disconnects, user events and
+// admin reads while some clients read too slowly to keep up. Run it with -race:
+//
+//	go run -race ./cmd/wsbench stress
+//	go run -race ./cmd/wsbench stress -transport epoll
+//
+// It fails if a slow client isn't evicted with CloseSlowConsumer or if the hub
+// still lists connections once every client is gone. This is the long-running
+// variant of TestEvictionStress in internal/ws, which go test runs briefly.
+func runStress(args []string) error {
+	fs := flag.NewFlagSet("stress", flag.ExitOnError)
+	duration := fs.Duration("duration", 10*time.Second, "how long to run")
+	channels := fs.Int("channels", 2, "channels to spread clients and events over")
+	rate := fs.Int("rate", 10000, "events published per second")
+	size := fs.Int("size", 1024, "approximate event size in bytes")
+	churners := fs.Int("churners", 8, "goroutines connecting and disconnecting in a loop")
+	slow := fs.Int("slow", 4, "clients that read too slowly to keep up")
+	transport := fs.String("transport", "goroutines", "how the server serves connections: goroutines or epoll")
+	fs.Parse(args)
+	if *churners < 1 || *slow < 1 {
+		return errors.New("-churners and -slow must be at least 1")
+	}
+
+	srv, err := newServer(ws.Options{NodeId: "bench", Transport: ws.TransportOptions{Mode: ws.TransportMode(*transport)}})
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	channelId := func(i int) string { return fmt.Sprintf("channel_%d", i%*channels) }
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Slow clients trickle-read until the run ends, then drain to the close
+	// frame. They keep reading so the server's blocked write can finish and
+	// the close frame gets through, as it would for a real slow client.
+	slowCodes := make([]int, *slow)
+	var slowWg sync.WaitGroup
+	for i := range slowCodes {
+		conn, err := srv.dial(fmt.Sprintf("slow_%d", i), channelId(i))
+		if err != nil {
+			return err
+		}
+
+		slowWg.Add(1)
+		go func(i int, conn *websocket.Conn) {
+			defer slowWg.Done()
+			defer conn.Close()
+			for {
+				select {
+				case <-stop:
+					conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+				default:
+					time.Sleep(5 * time.Millisecond)
+				}
+
+				_, _, err := conn.ReadMessage()
+				if err == nil {
+					continue
+				}
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					slowCodes[i] = closeErr.Code
+				} else {
+					fmt.Printf("slow client %d: %v\n", i, err)
+				}
+				return
+			}
+		}(i, conn)
+	}
+
+	// Publisher
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		payload := messageCreated(0, *size)
+		perTick := *rate / 1000
+		if perTick < 1 {
+			perTick = 1
+		}
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for j := 0; j < perTick; j++ {
+					srv.publish(channelId(i+j), payload)
+				}
+			}
+		}
+	}()
+
+	// Churners connect, read a little, and leave cleanly or abruptly
+	var connects, churnErrors atomic.Int64
+	for g := 0; g < *churners; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				conn, err := srv.dial(fmt.Sprintf("churn_%d_%d", g, i%4), channelId(rng.Intn(*channels)))
+				if err != nil {
+					churnErrors.Add(1)
+					continue
+				}
+				connects.Add(1)
+
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				for n := rng.Intn(20); n > 0; n-- {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						break
+					}
+				}
+
+				if rng.Intn(2) == 0 {
+					conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				}
+				conn.Close()
+			}
+		}(g)
+	}
+
+	// Admin reads and user events
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			srv.hub.Connections()
+			srv.hub.GetChannelUsers(channelId(i))
+			srv.hub.SendToUser(fmt.Sprintf("churn_%d_%d", i%*churners, i%4), messageCreated(i, 128))
+			srv.hub.SendToUser(fmt.Sprintf("slow_%d", i%*slow), messageCreated(i, 128))
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	time.Sleep(*duration)
+	close(stop)
+	wg.Wait()
+
+	// Slow clients must have been closed with CloseSlowConsumer
+	slowWg.Wait()
+	evicted := 0
+	for _, code := range slowCodes {
+		if code == ws.CloseSlowConsumer {
+			evicted++
+		}
+	}
+
+	// Every connection must be unregistered once the clients are gone
+	deadline := time.Now().Add(10 * time.Second)
+	remaining := len(srv.hub.Connections())
+	for remaining > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		remaining = len(srv.hub.Connections())
+	}
+
+	fmt.Printf("connects=%d connect-errors=%d slow-evicted=%d/%d remaining=%d\n",
+		connects.Load(), churnErrors.Load(), evicted, *slow, remaining)
+
+	if evicted != *slow {
+		return fmt.Errorf("%d slow clients were not evicted", *slow-evicted)
+	}
+	if remaining > 0 {
+		return fmt.Errorf("%d connections still registered", remaining)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// usage is the CPU time and write syscalls of the process so far
+type usage struct {
+	cpu    time.Duration
+	writes int64
+}
+
+func readUsage() usage {
+	var u usage
+
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err == nil {
+		u.cpu = time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+	}
+
+	u.writes = -1
+	if f, err := os.Open("/proc/self/io"); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if value, ok := strings.CutPrefix(scanner.Text(), "syscw: "); ok {
+				u.writes, _ = strconv.ParseInt(value, 10, 64)
+			}
+		}
+	}
+	return u
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import "time"
+
+// usage is the CPU time and write syscalls of the process so far, which are
+// only measured on Linux
+type usage struct {
+	cpu    time.Duration
+	writes int64
+}
+
+func readUsage() usage {
+	return usage{writes: -1}
+}
@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"go-websocket/internal/ws"
+	"net/http"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+// Handler serves the admin API, guarded by a static bearer token
+func Handler(hub *ws.Hub, token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/admin/connections", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeJSON(w, hub.Connections())
+	})
+
+	return requireToken(token, mux)
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
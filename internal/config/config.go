@@ -6,18 +6,131 @@ import (
 )
 
 type Config struct {
+	NodeId         string
 	Port           string
 	RedisURL       string
 	KindeIssuerURL string
 	LogLevel       string
+
+	// Encoding of events published to Redis: "json" or "protobuf"
+	RedisPayloadFormat string
+
+	// Rate limiting of client events, see ratelimit.ParseRules for the format
+	RateLimitConnRules  string
+	RateLimitUserRules  string
+	RateLimitAction     string
+	RateLimitCloseAfter int
+
+	// Connection admission limits, 0 disables a limit
+	MaxConnsPerUser   int
+	MaxConnsPerIP     int
+	MaxConnsPerNode   int
+	TrustedProxies    string
+	RetryAfterSeconds int
+
+	// Persistence of client-originated messages: "webhook", "stream" or "" to disable
+	MessageStore          string
+	MessageWebhookURL     string
+	MessageWebhookSecret  string
+	MessageWebhookTimeout int
+	MessageStreamKey      string
+	MessageStreamMaxLen   int
+	MessageMaxLength      int
+
+	// Send read:updated only to the message author
+	ReadReceiptsAuthorOnly bool
+
+	// Maximum payload size of client:* events in bytes
+	WhisperMaxSize int
+
+	// Interval of JSON heartbeat pings in seconds, 0 disables them
+	AppHeartbeatInterval int
+
+	// permessage-deflate, see ws.CompressionOptions
+	CompressionEnabled bool
+	CompressionLevel   int
+	CompressionMinSize int
+
+	// Maximum frames WritePump sends with one network write
+	WriteCoalesceMaxFrames int
+
+	// What gives way when a client's queue is full, see ws.BackpressureOptions
+	BackpressurePolicy string
+	BackpressureRules  string
+
+	// Channel buckets of the hub and the broadcasts each can queue
+	HubBuckets         int
+	HubBucketQueueSize int
+
+	// Events kept per channel for replay and for how long in seconds; 0
+	// events disables sequence numbers
+	HistoryMaxEvents int
+	HistoryTTL       int
+
+	// Events sent per replay request at most
+	ReplayMaxEvents int
+
+	// How idle connections are served: "goroutines" or "epoll"
+	TransportMode string
+
+	// Bearer token of the admin API, which is disabled if empty
+	AdminToken string
 }
 
 func Load() *Config {
 	return &Config{
+		NodeId:         getEnv("NODE_ID", hostname()),
 		Port:           getEnv("PORT", "8080"),
 		RedisURL:       getEnv("REDIS_URL", "redis://localhost:6379"),
 		KindeIssuerURL: getEnv("KINDE_ISSUER_URL", ""),
 		LogLevel:       getEnv("LOG_LEVEL", "info"),
+
+		RedisPayloadFormat: getEnv("REDIS_PAYLOAD_FORMAT", "json"),
+
+		RateLimitConnRules:  getEnv("RATE_LIMIT_CONN_RULES", "typing:start=5/1s,typing:stop=5/1s,client:*=30/1s,*=20/1s"),
+		RateLimitUserRules:  getEnv("RATE_LIMIT_USER_RULES", "typing:start=10/1s,typing:stop=10/1s"),
+		RateLimitAction:     getEnv("RATE_LIMIT_ACTION", "error"),
+		RateLimitCloseAfter: getEnvInt("RATE_LIMIT_CLOSE_AFTER", 20),
+
+		MaxConnsPerUser:   getEnvInt("MAX_CONNS_PER_USER", 10),
+		MaxConnsPerIP:     getEnvInt("MAX_CONNS_PER_IP", 100),
+		MaxConnsPerNode:   getEnvInt("MAX_CONNS_PER_NODE", 0),
+		TrustedProxies:    getEnv("TRUSTED_PROXIES", ""),
+		RetryAfterSeconds: getEnvInt("ADMISSION_RETRY_AFTER", 10),
+
+		MessageStore:          getEnv("MESSAGE_STORE", ""),
+		MessageWebhookURL:     getEnv("MESSAGE_WEBHOOK_URL", ""),
+		MessageWebhookSecret:  getEnv("MESSAGE_WEBHOOK_SECRET", ""),
+		MessageWebhookTimeout: getEnvInt("MESSAGE_WEBHOOK_TIMEOUT", 5),
+		MessageStreamKey:      getEnv("MESSAGE_STREAM_KEY", "messages"),
+		MessageStreamMaxLen:   getEnvInt("MESSAGE_STREAM_MAXLEN", 100000),
+		MessageMaxLength:      getEnvInt("MESSAGE_MAX_LENGTH", 4000),
+
+		ReadReceiptsAuthorOnly: getEnvBool("READ_RECEIPTS_AUTHOR_ONLY", false),
+
+		WhisperMaxSize: getEnvInt("WHISPER_MAX_SIZE", 4096),
+
+		AppHeartbeatInterval: getEnvInt("APP_HEARTBEAT_INTERVAL", 25),
+
+		CompressionEnabled: getEnvBool("COMPRESSION_ENABLED", true),
+		CompressionLevel:   getEnvInt("COMPRESSION_LEVEL", 1),
+		CompressionMinSize: getEnvInt("COMPRESSION_MIN_SIZE", 512),
+
+		WriteCoalesceMaxFrames: getEnvInt("WRITE_COALESCE_MAX_FRAMES", 64),
+
+		BackpressurePolicy: getEnv("BACKPRESSURE_POLICY", "disconnect"),
+		BackpressureRules:  getEnv("BACKPRESSURE_RULES", ""),
+
+		HubBuckets:         getEnvInt("HUB_BUCKETS", 32),
+		HubBucketQueueSize: getEnvInt("HUB_BUCKET_QUEUE_SIZE", 1024),
+
+		HistoryMaxEvents: getEnvInt("HISTORY_MAX_EVENTS", 1000),
+		HistoryTTL:       getEnvInt("HISTORY_TTL", 86400),
+		ReplayMaxEvents:  getEnvInt("REPLAY_MAX_EVENTS", 100),
+
+		TransportMode: getEnv("TRANSPORT_MODE", "goroutines"),
+
+		AdminToken: getEnv("ADMIN_TOKEN", ""),
 	}
 }
 
@@ -36,3 +149,20 @@ func getEnvInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Minimal Prometheus text exposition for the server's own metrics
+
+type metric interface {
+	write(sb *strings.Builder)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]metric{}
+)
+
+func register(name string, m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[name]; exists {
+		panic("metrics: duplicate metric " + name)
+	}
+	registry[name] = m
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	name string
+	help string
+	v    atomic.Int64
+}
+
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	register(name, c)
+	return c
+}
+
+func (c *Counter) Inc()         { c.v.Add(1) }
+func (c *Counter) Add(n int64)  { c.v.Add(n) }
+func (c *Counter) Value() int64 { return c.v.Load() }
+
+func (c *Counter) write(sb *strings.Builder) {
+	writeHeader(sb, c.name, c.help, "counter")
+	fmt.Fprintf(sb, "%s %d\n", c.name, c.v.Load())
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	name string
+	help string
+	v    atomic.Int64
+}
+
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(name, g)
+	return g
+}
+
+func (g *Gauge) Inc()         { g.v.Add(1) }
+func (g *Gauge) Dec()         { g.v.Add(-1) }
+func (g *Gauge) Add(n int64)  { g.v.Add(n) }
+func (g *Gauge) Set(n int64)  { g.v.Store(n) }
+func (g *Gauge) Value() int64 { return g.v.Load() }
+
+func (g *Gauge) write(sb *strings.Builder) {
+	writeHeader(sb, g.name, g.help, "gauge")
+	fmt.Fprintf(sb, "%s %d\n", g.name, g.v.Load())
+}
+
+// CounterVec is a set of counters partitioned by a single label
+type CounterVec struct {
+	name  string
+	help  string
+	label string
+
+	mu       sync.RWMutex
+	counters map[string]*atomic.Int64
+}
+
+func NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{name: name, help: help, label: label, counters: map[string]*atomic.Int64{}}
+	register(name, v)
+	return v
+}
+
+func (v *CounterVec) Inc(labelValue string) {
+	v.Add(labelValue, 1)
+}
+
+func (v *CounterVec) Add(labelValue string, n int64) {
+	v.mu.RLock()
+	c, ok := v.counters[labelValue]
+	v.mu.RUnlock()
+
+	if !ok {
+		v.mu.Lock()
+		if c, ok = v.counters[labelValue]; !ok {
+			c = &atomic.Int64{}
+			v.counters[labelValue] = c
+		}
+		v.mu.Unlock()
+	}
+	c.Add(n)
+}
+
+func (v *CounterVec) write(sb *strings.Builder) {
+	writeHeader(sb, v.name, v.help, "counter")
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	values := make([]string, 0, len(v.counters))
+	for value := range v.counters {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	for _, value := range values {
+		fmt.Fprintf(sb, "%s{%s=%q} %d\n", v.name, v.label, value, v.counters[value].Load())
+	}
+}
+
+// GaugeFunc reports the value returned by fn at scrape time
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(sb *strings.Builder) {
+	writeHeader(sb, g.name, g.help, "gauge")
+	fmt.Fprintf(sb, "%s %g\n", g.name, g.fn())
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+// NewHistogram creates a histogram with the given upper bounds, in increasing order
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{name: name, help: help, buckets: buckets, counts: make([]int64, len(buckets))}
+	register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) write(sb *strings.Builder) {
+	writeHeader(sb, h.name, h.help, "histogram")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		fmt.Fprintf(sb, "%s_bucket{le=\"%g\"} %d\n", h.name, bound, h.counts[i])
+	}
+	fmt.Fprintf(sb, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(sb, "%s_sum %g\n", h.name, h.sum)
+	fmt.Fprintf(sb, "%s_count %d\n", h.name, h.count)
+}
+
+func writeHeader(sb *strings.Builder, name, help, kind string) {
+	fmt.Fprintf(sb, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(sb, "# TYPE %s %s\n", name, kind)
+}
+
+// Handler serves all registered metrics in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryMu.RLock()
+		names := make([]string, 0, len(registry))
+		for name := range registry {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var sb strings.Builder
+		for _, name := range names {
+			registry[name].write(&sb)
+		}
+		registryMu.RUnlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(sb.String()))
+	})
+}
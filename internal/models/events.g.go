@@ -1,15 +1,43 @@
 package models
 
+import "github.com/goccy/go-json"
+
 type Event struct {
 	Type      string      `json:"type"`
 	ChannelId string      `json:"channelId"`
 	Timestamp int64       `json:"timestamp"`
+	Seq       int64       `json:"seq,omitempty"`
 	Data      interface{} `json:"data"`
+
+	// Connection or user that must not receive the event, e.g. its sender
+	ExcludeConnectionId string `json:"excludeConnectionId,omitempty"`
+	ExcludeUserId       string `json:"excludeUserId,omitempty"`
 }
 
 type BroadcastMessage struct {
 	ChannelId string
 	Payload   []byte
+
+	// Event type, and the key of events superseding each other in the queues
+	// of slow clients, e.g. the typing state of a user
+	Type string
+	Key  string
+
+	// Position in the channel's sequence, 0 for ephemeral events
+	Seq int64
+
+	// Events inside a thread only reach connections subscribed to ThreadId;
+	// the others receive ActivityPayload instead, if set
+	ThreadId        string
+	ActivityPayload []byte
+
+	// Connection and user skipped during fan-out
+	ExcludeConnectionId string
+	ExcludeUserId       string
+
+	// If set, connections of UserId receive UserPayload instead of Payload
+	UserId      string
+	UserPayload []byte
 }
 
 // Specific event data structures
@@ -23,6 +51,11 @@ type MessageCreatedData struct {
 	AuthorEmail  string `json:"authorEmail"`
 	AuthorAvatar string `json:"authorAvatar"`
 	CreatedAt    string `json:"createdAt"`
+	ThreadId     string `json:"threadId,omitempty"`
+	// Client nonce of the message:send that created the message. Only
+	// delivered to the author's connections so they can reconcile their
+	// optimistic copy.
+	Nonce string `json:"nonce,omitempty"`
 }
 
 type TypingData struct {
@@ -35,3 +68,115 @@ type PresenceData struct {
 	UserName   string `json:"userName"`
 	UserAvatar string `json:"userAvatar,omitempty"`
 }
+
+type ErrorData struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Correlation id of the client message that caused the error, if it had one
+	Id string `json:"id,omitempty"`
+}
+
+type AckData struct {
+	// Correlation id of the acknowledged client message
+	Id     string      `json:"id"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+// MessageDraft is a message sent by a client, before it has been persisted
+type MessageDraft struct {
+	ChannelId    string `json:"channelId"`
+	ThreadId     string `json:"threadId,omitempty"`
+	Content      string `json:"content"`
+	ImageUrl     string `json:"imageUrl,omitempty"`
+	AuthorId     string `json:"authorId"`
+	AuthorName   string `json:"authorName"`
+	AuthorEmail  string `json:"authorEmail"`
+	AuthorAvatar string `json:"authorAvatar"`
+}
+
+type MessageUpdatedData struct {
+	ID        string `json:"id"`
+	Content   string `json:"content"`
+	ImageUrl  string `json:"imageUrl,omitempty"`
+	EditedBy  string `json:"editedBy,omitempty"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+type MessageDeletedData struct {
+	ID string `json:"id"`
+	// Hard deletes remove the message entirely; soft deletes leave a placeholder
+	Hard      bool   `json:"hard"`
+	DeletedBy string `json:"deletedBy,omitempty"`
+	DeletedAt string `json:"deletedAt"`
+}
+
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+// ReactionData describes a reaction:added or reaction:removed event. Reactions
+// holds the message's aggregated counts after the change.
+type ReactionData struct {
+	MessageId string          `json:"messageId"`
+	Emoji     string          `json:"emoji"`
+	UserId    string          `json:"userId"`
+	Reactions []ReactionCount `json:"reactions"`
+}
+
+type ReadReceiptData struct {
+	UserId    string `json:"userId"`
+	MessageId string `json:"messageId"`
+	ThreadId  string `json:"threadId,omitempty"`
+	ReadAt    string `json:"readAt"`
+}
+
+type UnreadData struct {
+	ChannelId string `json:"channelId"`
+	Count     int64  `json:"count"`
+}
+
+// ThreadActivityData summarizes a new reply for connections not viewing the thread
+type ThreadActivityData struct {
+	ThreadId   string `json:"threadId"`
+	MessageId  string `json:"messageId"`
+	AuthorId   string `json:"authorId"`
+	AuthorName string `json:"authorName"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+// WhisperData wraps an ephemeral client:* event relayed between clients
+type WhisperData struct {
+	// Verified sender of the event
+	UserId   string          `json:"userId"`
+	UserName string          `json:"userName"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+}
+
+// ConnectionData is sent to a client in the connection:established welcome frame
+type ConnectionData struct {
+	// Id to pass as excludeConnectionId when publishing events triggered by this connection
+	ConnectionId string   `json:"connectionId"`
+	NodeId       string   `json:"nodeId"`
+	UserId       string   `json:"userId"`
+	Channels     []string `json:"channels"`
+
+	Protocol            string           `json:"protocol"`
+	ProtocolVersion     int              `json:"protocolVersion"`
+	Compression         bool             `json:"compression"`
+	HeartbeatIntervalMs int64            `json:"heartbeatIntervalMs"`
+	Limits              ConnectionLimits `json:"limits"`
+}
+
+type ConnectionLimits struct {
+	MaxMessageSize int `json:"maxMessageSize"`
+
+	// Per event type, for this connection and for all of the user's connections
+	RateLimits     map[string]RateLimit `json:"rateLimits,omitempty"`
+	UserRateLimits map[string]RateLimit `json:"userRateLimits,omitempty"`
+}
+
+type RateLimit struct {
+	Limit    int   `json:"limit"`
+	PeriodMs int64 `json:"periodMs"`
+}
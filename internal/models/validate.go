@@ -0,0 +1,180 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	EventMessageCreated  = "message:created"
+	EventMessageUpdated  = "message:updated"
+	EventMessageDeleted  = "message:deleted"
+	EventReactionAdded   = "reaction:added"
+	EventReactionRemoved = "reaction:removed"
+	EventTypingStart     = "typing:start"
+	EventTypingStop      = "typing:stop"
+	EventPresenceJoin    = "presence:join"
+	EventPresenceLeave   = "presence:leave"
+	EventReadUpdated     = "read:updated"
+	EventUnreadUpdated   = "unread:updated"
+	EventThreadActivity  = "thread:activity"
+	EventSeqSkip         = "seq:skip"
+	EventConnected       = "connection:established"
+)
+
+// Namespace of ephemeral events relayed between clients
+const WhisperNamespace = "client:"
+
+// Ephemeral reports whether events of a type only matter for a moment: they
+// are not numbered or kept in channel history, and give way first to others
+func Ephemeral(eventType string) bool {
+	switch eventType {
+	case EventTypingStart, EventTypingStop, EventPresenceJoin, EventPresenceLeave:
+		return true
+	}
+	return strings.HasPrefix(eventType, WhisperNamespace)
+}
+
+// RawEvent is an Event whose data hasn't been decoded yet
+type RawEvent struct {
+	Type      string          `json:"type"`
+	ChannelId string          `json:"channelId"`
+	Timestamp int64           `json:"timestamp"`
+	Seq       int64           `json:"seq,omitempty"`
+	Data      json.RawMessage `json:"data"`
+
+	ExcludeConnectionId string `json:"excludeConnectionId,omitempty"`
+	ExcludeUserId       string `json:"excludeUserId,omitempty"`
+}
+
+type validator interface {
+	Validate() error
+}
+
+// Event types with a known data shape. Other types are passed through unchecked.
+var eventData = map[string]func() validator{
+	EventMessageCreated:  func() validator { return &MessageCreatedData{} },
+	EventMessageUpdated:  func() validator { return &MessageUpdatedData{} },
+	EventMessageDeleted:  func() validator { return &MessageDeletedData{} },
+	EventReactionAdded:   func() validator { return &ReactionData{} },
+	EventReactionRemoved: func() validator { return &ReactionData{} },
+	EventTypingStart:     func() validator { return &TypingData{} },
+	EventTypingStop:      func() validator { return &TypingData{} },
+	EventPresenceJoin:    func() validator { return &PresenceData{} },
+	EventPresenceLeave:   func() validator { return &PresenceData{} },
+	EventReadUpdated:     func() validator { return &ReadReceiptData{} },
+	EventUnreadUpdated:   func() validator { return &UnreadData{} },
+}
+
+// Validate checks the envelope and, for known event types, the data shape
+func (e *RawEvent) Validate() error {
+	if e.Type == "" {
+		return errors.New("missing type")
+	}
+	if e.ChannelId == "" {
+		return errors.New("missing channelId")
+	}
+
+	newData, ok := eventData[e.Type]
+	if !ok {
+		if !strings.HasPrefix(e.Type, WhisperNamespace) {
+			return nil
+		}
+		newData = func() validator { return &WhisperData{} }
+	}
+
+	data := newData()
+	if err := json.Unmarshal(e.Data, data); err != nil {
+		return fmt.Errorf("invalid %s data: %w", e.Type, err)
+	}
+	if err := data.Validate(); err != nil {
+		return fmt.Errorf("invalid %s data: %w", e.Type, err)
+	}
+	return nil
+}
+
+func (d *MessageCreatedData) Validate() error {
+	switch {
+	case d.ID == "":
+		return errors.New("missing id")
+	case d.AuthorId == "":
+		return errors.New("missing authorId")
+	}
+	return nil
+}
+
+func (d *MessageUpdatedData) Validate() error {
+	switch {
+	case d.ID == "":
+		return errors.New("missing id")
+	case d.Content == "" && d.ImageUrl == "":
+		return errors.New("missing content")
+	}
+	return nil
+}
+
+func (d *MessageDeletedData) Validate() error {
+	if d.ID == "" {
+		return errors.New("missing id")
+	}
+	return nil
+}
+
+func (d *ReactionData) Validate() error {
+	switch {
+	case d.MessageId == "":
+		return errors.New("missing messageId")
+	case d.Emoji == "":
+		return errors.New("missing emoji")
+	case d.UserId == "":
+		return errors.New("missing userId")
+	}
+
+	for _, r := range d.Reactions {
+		if r.Emoji == "" || r.Count < 0 {
+			return errors.New("invalid reaction count")
+		}
+	}
+	return nil
+}
+
+func (d *TypingData) Validate() error {
+	if d.UserId == "" {
+		return errors.New("missing userId")
+	}
+	return nil
+}
+
+func (d *PresenceData) Validate() error {
+	if d.UserId == "" {
+		return errors.New("missing userId")
+	}
+	return nil
+}
+
+func (d *ReadReceiptData) Validate() error {
+	switch {
+	case d.UserId == "":
+		return errors.New("missing userId")
+	case d.MessageId == "":
+		return errors.New("missing messageId")
+	}
+	return nil
+}
+
+func (d *UnreadData) Validate() error {
+	if d.ChannelId == "" {
+		return errors.New("missing channelId")
+	}
+	return nil
+}
+
+func (d *WhisperData) Validate() error {
+	if d.UserId == "" {
+		return errors.New("missing userId")
+	}
+	return nil
+}
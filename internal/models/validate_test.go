@@ -0,0 +1,89 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRawEventValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		data      string
+		noChannel bool
+		// Substring of the error, or "" if the event is valid
+		wantErr string
+	}{
+		{name: "missing type", data: `{}`, wantErr: "missing type"},
+		{name: "missing channelId", eventType: EventMessageDeleted, data: `{"id":"m1"}`, noChannel: true, wantErr: "missing channelId"},
+
+		{name: "message:created", eventType: EventMessageCreated, data: `{"id":"m1","authorId":"u1","content":"hi"}`},
+		{name: "message:created without id", eventType: EventMessageCreated, data: `{"authorId":"u1"}`, wantErr: "missing id"},
+		{name: "message:created without author", eventType: EventMessageCreated, data: `{"id":"m1"}`, wantErr: "missing authorId"},
+		{name: "message:updated", eventType: EventMessageUpdated, data: `{"id":"m1","content":"edited"}`},
+		{name: "message:updated with only an image", eventType: EventMessageUpdated, data: `{"id":"m1","imageUrl":"https://x/y.png"}`},
+		{name: "message:updated without content", eventType: EventMessageUpdated, data: `{"id":"m1"}`, wantErr: "missing content"},
+		{name: "message:deleted", eventType: EventMessageDeleted, data: `{"id":"m1"}`},
+		{name: "message:deleted without id", eventType: EventMessageDeleted, data: `{}`, wantErr: "missing id"},
+		{name: "reaction:added", eventType: EventReactionAdded, data: `{"messageId":"m1","emoji":"+1","userId":"u1","reactions":[{"emoji":"+1","count":2}]}`},
+		{name: "reaction:removed without emoji", eventType: EventReactionRemoved, data: `{"messageId":"m1","userId":"u1"}`, wantErr: "missing emoji"},
+		{name: "reaction without messageId", eventType: EventReactionAdded, data: `{"emoji":"+1","userId":"u1"}`, wantErr: "missing messageId"},
+		{name: "reaction without userId", eventType: EventReactionAdded, data: `{"messageId":"m1","emoji":"+1"}`, wantErr: "missing userId"},
+		{name: "reaction with a negative count", eventType: EventReactionAdded, data: `{"messageId":"m1","emoji":"+1","userId":"u1","reactions":[{"emoji":"+1","count":-1}]}`, wantErr: "invalid reaction count"},
+		{name: "reaction count without emoji", eventType: EventReactionAdded, data: `{"messageId":"m1","emoji":"+1","userId":"u1","reactions":[{"count":1}]}`, wantErr: "invalid reaction count"},
+		{name: "typing:start", eventType: EventTypingStart, data: `{"userId":"u1","threadId":"t1"}`},
+		{name: "typing:stop without userId", eventType: EventTypingStop, data: `{}`, wantErr: "missing userId"},
+		{name: "presence:join", eventType: EventPresenceJoin, data: `{"userId":"u1"}`},
+		{name: "presence:leave without userId", eventType: EventPresenceLeave, data: `{"userName":"U"}`, wantErr: "missing userId"},
+		{name: "read:updated", eventType: EventReadUpdated, data: `{"userId":"u1","messageId":"m1"}`},
+		{name: "read:updated without messageId", eventType: EventReadUpdated, data: `{"userId":"u1"}`, wantErr: "missing messageId"},
+		{name: "unread:updated", eventType: EventUnreadUpdated, data: `{"channelId":"c","count":3}`},
+		{name: "unread:updated without channelId", eventType: EventUnreadUpdated, data: `{"count":3}`, wantErr: "missing channelId"},
+
+		{name: "whisper", eventType: "client:cursor", data: `{"userId":"u1","payload":{"x":1}}`},
+		{name: "whisper without sender", eventType: "client:cursor", data: `{"payload":{"x":1}}`, wantErr: "missing userId"},
+		{name: "whisper without data", eventType: "client:cursor", wantErr: "invalid client:cursor data"},
+
+		{name: "known type with wrong data", eventType: EventMessageDeleted, data: `"m1"`, wantErr: "invalid message:deleted data"},
+		{name: "known type without data", eventType: EventTypingStart, wantErr: "invalid typing:start data"},
+		{name: "unknown types pass through", eventType: "poll:closed", data: `{"anything":true}`},
+		{name: "unknown types pass through without data", eventType: "poll:closed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := RawEvent{Type: tt.eventType, ChannelId: "c", Data: []byte(tt.data)}
+			if tt.noChannel {
+				event.ChannelId = ""
+			}
+
+			err := event.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("Validate() = nil, want %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEphemeral(t *testing.T) {
+	for eventType, want := range map[string]bool{
+		EventTypingStart:    true,
+		EventTypingStop:     true,
+		EventPresenceJoin:   true,
+		EventPresenceLeave:  true,
+		"client:cursor":     true,
+		EventMessageCreated: false,
+		EventReadUpdated:    false,
+		EventSeqSkip:        false,
+		"clientx:cursor":    false,
+	} {
+		if got := Ephemeral(eventType); got != want {
+			t.Errorf("Ephemeral(%q) = %v, want %v", eventType, got, want)
+		}
+	}
+}
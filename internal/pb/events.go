@@ -0,0 +1,291 @@
+package pb
+
+import (
+	"bytes"
+	"go-websocket/internal/models"
+
+	"github.com/goccy/go-json"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Event is the gows.v2.Event message
+type Event struct {
+	Type      string
+	ChannelId string
+	Timestamp int64
+	Seq       int64
+
+	// Members of the data oneof, at most one is set
+	MessageCreated *MessageCreatedData
+	Typing         *TypingData
+	Presence       *PresenceData
+	JsonData       []byte
+
+	ExcludeConnectionId string
+	ExcludeUserId       string
+}
+
+type MessageCreatedData struct {
+	ID           string `json:"id"`
+	Content      string `json:"content"`
+	ImageUrl     string `json:"imageUrl,omitempty"`
+	AuthorId     string `json:"authorId"`
+	AuthorName   string `json:"authorName"`
+	AuthorEmail  string `json:"authorEmail"`
+	AuthorAvatar string `json:"authorAvatar"`
+	CreatedAt    string `json:"createdAt"`
+	ThreadId     string `json:"threadId,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`
+}
+
+type TypingData struct {
+	UserId   string `json:"userId"`
+	UserName string `json:"userName,omitempty"`
+	ThreadId string `json:"threadId,omitempty"`
+}
+
+type PresenceData struct {
+	UserId     string `json:"userId"`
+	UserName   string `json:"userName,omitempty"`
+	UserAvatar string `json:"userAvatar,omitempty"`
+}
+
+// EventFromJSON converts a JSON event. Data is only mapped to a typed message
+// if it has no fields the message lacks; otherwise it is kept as JSON.
+func EventFromJSON(payload []byte) (*Event, error) {
+	var raw models.RawEvent
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, err
+	}
+
+	e := &Event{
+		Type:                raw.Type,
+		ChannelId:           raw.ChannelId,
+		Timestamp:           raw.Timestamp,
+		Seq:                 raw.Seq,
+		ExcludeConnectionId: raw.ExcludeConnectionId,
+		ExcludeUserId:       raw.ExcludeUserId,
+	}
+	e.setData(raw.Data)
+	return e, nil
+}
+
+func (e *Event) setData(data json.RawMessage) {
+	if len(data) == 0 || string(data) == "null" {
+		return
+	}
+
+	switch e.Type {
+	case models.EventMessageCreated:
+		var d MessageCreatedData
+		if decodeStrict(data, &d) {
+			e.MessageCreated = &d
+			return
+		}
+	case models.EventTypingStart, models.EventTypingStop:
+		var d TypingData
+		if decodeStrict(data, &d) {
+			e.Typing = &d
+			return
+		}
+	case models.EventPresenceJoin, models.EventPresenceLeave:
+		var d PresenceData
+		if decodeStrict(data, &d) {
+			e.Presence = &d
+			return
+		}
+	}
+	e.JsonData = data
+}
+
+func decodeStrict(data []byte, v interface{}) bool {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v) == nil
+}
+
+// JSON converts the event back to the JSON envelope
+func (e *Event) JSON() ([]byte, error) {
+	return json.Marshal(models.Event{
+		Type:                e.Type,
+		ChannelId:           e.ChannelId,
+		Timestamp:           e.Timestamp,
+		Seq:                 e.Seq,
+		Data:                e.data(),
+		ExcludeConnectionId: e.ExcludeConnectionId,
+		ExcludeUserId:       e.ExcludeUserId,
+	})
+}
+
+func (e *Event) data() interface{} {
+	switch {
+	case e.MessageCreated != nil:
+		return e.MessageCreated
+	case e.Typing != nil:
+		return e.Typing
+	case e.Presence != nil:
+		return e.Presence
+	case e.JsonData != nil:
+		return json.RawMessage(e.JsonData)
+	}
+	return nil
+}
+
+func (e *Event) clearData() {
+	e.MessageCreated, e.Typing, e.Presence, e.JsonData = nil, nil, nil, nil
+}
+
+func (e *Event) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, e.Type)
+	b = appendString(b, 2, e.ChannelId)
+	b = appendInt64(b, 3, e.Timestamp)
+	b = appendInt64(b, 7, e.Seq)
+
+	switch {
+	case e.MessageCreated != nil:
+		b = appendBytes(b, 4, e.MessageCreated.Marshal())
+	case e.Typing != nil:
+		b = appendBytes(b, 5, e.Typing.Marshal())
+	case e.Presence != nil:
+		b = appendBytes(b, 6, e.Presence.Marshal())
+	case e.JsonData != nil:
+		b = appendBytes(b, 15, e.JsonData)
+	}
+
+	b = appendString(b, 16, e.ExcludeConnectionId)
+	b = appendString(b, 17, e.ExcludeUserId)
+	return b
+}
+
+// AppendSeqTag appends the tag of the seq field, for publishers that append
+// its value later
+func AppendSeqTag(b []byte) []byte {
+	return protowire.AppendTag(b, 7, protowire.VarintType)
+}
+
+func (e *Event) Unmarshal(b []byte) error {
+	*e = Event{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &e.Type)
+		case 2:
+			return consumeString(typ, b, &e.ChannelId)
+		case 3:
+			return consumeInt64(typ, b, &e.Timestamp)
+		case 7:
+			return consumeInt64(typ, b, &e.Seq)
+		case 4:
+			d := &MessageCreatedData{}
+			e.clearData()
+			e.MessageCreated = d
+			return consumeMessage(typ, b, d.Unmarshal)
+		case 5:
+			d := &TypingData{}
+			e.clearData()
+			e.Typing = d
+			return consumeMessage(typ, b, d.Unmarshal)
+		case 6:
+			d := &PresenceData{}
+			e.clearData()
+			e.Presence = d
+			return consumeMessage(typ, b, d.Unmarshal)
+		case 15:
+			e.clearData()
+			return consumeBytes(typ, b, &e.JsonData)
+		case 16:
+			return consumeString(typ, b, &e.ExcludeConnectionId)
+		case 17:
+			return consumeString(typ, b, &e.ExcludeUserId)
+		}
+		return 0, nil
+	})
+}
+
+func (d *MessageCreatedData) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, d.ID)
+	b = appendString(b, 2, d.Content)
+	b = appendString(b, 3, d.ImageUrl)
+	b = appendString(b, 4, d.AuthorId)
+	b = appendString(b, 5, d.AuthorName)
+	b = appendString(b, 6, d.AuthorEmail)
+	b = appendString(b, 7, d.AuthorAvatar)
+	b = appendString(b, 8, d.CreatedAt)
+	b = appendString(b, 9, d.ThreadId)
+	b = appendString(b, 10, d.Nonce)
+	return b
+}
+
+func (d *MessageCreatedData) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &d.ID)
+		case 2:
+			return consumeString(typ, b, &d.Content)
+		case 3:
+			return consumeString(typ, b, &d.ImageUrl)
+		case 4:
+			return consumeString(typ, b, &d.AuthorId)
+		case 5:
+			return consumeString(typ, b, &d.AuthorName)
+		case 6:
+			return consumeString(typ, b, &d.AuthorEmail)
+		case 7:
+			return consumeString(typ, b, &d.AuthorAvatar)
+		case 8:
+			return consumeString(typ, b, &d.CreatedAt)
+		case 9:
+			return consumeString(typ, b, &d.ThreadId)
+		case 10:
+			return consumeString(typ, b, &d.Nonce)
+		}
+		return 0, nil
+	})
+}
+
+func (d *TypingData) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, d.UserId)
+	b = appendString(b, 2, d.UserName)
+	b = appendString(b, 3, d.ThreadId)
+	return b
+}
+
+func (d *TypingData) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &d.UserId)
+		case 2:
+			return consumeString(typ, b, &d.UserName)
+		case 3:
+			return consumeString(typ, b, &d.ThreadId)
+		}
+		return 0, nil
+	})
+}
+
+func (d *PresenceData) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, d.UserId)
+	b = appendString(b, 2, d.UserName)
+	b = appendString(b, 3, d.UserAvatar)
+	return b
+}
+
+func (d *PresenceData) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &d.UserId)
+		case 2:
+			return consumeString(typ, b, &d.UserName)
+		case 3:
+			return consumeString(typ, b, &d.UserAvatar)
+		}
+		return 0, nil
+	})
+}
@@ -0,0 +1,198 @@
+package pb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEventWire(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  []byte
+	}{
+		{
+			name: "message_created",
+			event: Event{
+				Type: "message:created", ChannelId: "c", Timestamp: 1700000000, Seq: 12,
+				MessageCreated: &MessageCreatedData{
+					ID: "m1", Content: "hi", ImageUrl: "img", AuthorId: "u1", AuthorName: "U",
+					AuthorEmail: "u@x", AuthorAvatar: "av", CreatedAt: "now", ThreadId: "t1", Nonce: "n1",
+				},
+			},
+			want: concat(
+				strField(1, "message:created"), strField(2, "c"), varintField(3, 1700000000), varintField(7, 12),
+				msgField(4,
+					strField(1, "m1"), strField(2, "hi"), strField(3, "img"), strField(4, "u1"), strField(5, "U"),
+					strField(6, "u@x"), strField(7, "av"), strField(8, "now"), strField(9, "t1"), strField(10, "n1"),
+				),
+			),
+		},
+		{
+			name: "typing",
+			event: Event{
+				Type: "typing:start", ChannelId: "c",
+				Typing: &TypingData{UserId: "u1", UserName: "U", ThreadId: "t1"},
+			},
+			want: concat(
+				strField(1, "typing:start"), strField(2, "c"),
+				msgField(5, strField(1, "u1"), strField(2, "U"), strField(3, "t1")),
+			),
+		},
+		{
+			name: "presence",
+			event: Event{
+				Type: "presence:join", ChannelId: "c",
+				Presence: &PresenceData{UserId: "u1", UserName: "U", UserAvatar: "av"},
+			},
+			want: concat(
+				strField(1, "presence:join"), strField(2, "c"),
+				msgField(6, strField(1, "u1"), strField(2, "U"), strField(3, "av")),
+			),
+		},
+		{
+			name:  "json_data",
+			event: Event{Type: "reaction:added", ChannelId: "c", Seq: 3, JsonData: []byte(`{"messageId":"m1"}`)},
+			want: concat(
+				strField(1, "reaction:added"), strField(2, "c"), varintField(7, 3),
+				strField(15, `{"messageId":"m1"}`),
+			),
+		},
+		{
+			name:  "empty data message",
+			event: Event{Type: "typing:stop", Typing: &TypingData{}},
+			want:  concat(strField(1, "typing:stop"), msgField(5)),
+		},
+		{
+			name:  "exclude fields",
+			event: Event{Type: "read:updated", ChannelId: "c", ExcludeConnectionId: "conn_1", ExcludeUserId: "u1"},
+			want: concat(
+				strField(1, "read:updated"), strField(2, "c"),
+				strField(16, "conn_1"), strField(17, "u1"),
+			),
+		},
+		{
+			name:  "negative timestamp",
+			event: Event{Type: "seq:skip", Timestamp: -5},
+			want:  concat(strField(1, "seq:skip"), varintField(3, -5)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.Marshal(); !bytes.Equal(got, tt.want) {
+				t.Errorf("Marshal() = %x, want %x", got, tt.want)
+			}
+
+			var got Event
+			if err := got.Unmarshal(tt.want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.event) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.event)
+			}
+		})
+	}
+}
+
+func TestEventUnmarshalSkipsUnknownFields(t *testing.T) {
+	payload := concat(
+		unknownFields(),
+		strField(1, "typing:start"),
+		// A known field with the wrong wire type is skipped too
+		varintField(2, 1),
+		msgField(5, strField(1, "u1"), unknownFields()),
+		varintField(16, 1),
+		unknownFields(),
+	)
+	want := Event{Type: "typing:start", Typing: &TypingData{UserId: "u1"}}
+
+	var got Event
+	if err := got.Unmarshal(payload); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, want)
+	}
+}
+
+func TestEventUnmarshalLastDataWins(t *testing.T) {
+	payload := concat(
+		msgField(5, strField(1, "u1")),
+		strField(15, `{"a":1}`),
+		msgField(6, strField(1, "u2")),
+	)
+	want := Event{Presence: &PresenceData{UserId: "u2"}}
+
+	var got Event
+	if err := got.Unmarshal(payload); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, want)
+	}
+}
+
+func TestEventFromJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    Event
+		// JSON returns the payload unchanged
+		same bool
+	}{
+		{
+			name:    "typed data",
+			payload: `{"type":"typing:stop","channelId":"c","timestamp":1,"seq":0,"data":{"userId":"u1","threadId":"t1"}}`,
+			want:    Event{Type: "typing:stop", ChannelId: "c", Timestamp: 1, Typing: &TypingData{UserId: "u1", ThreadId: "t1"}},
+		},
+		{
+			name:    "fields the data message lacks are kept as JSON",
+			payload: `{"type":"typing:stop","channelId":"c","timestamp":1,"data":{"userId":"u1","extra":1}}`,
+			want:    Event{Type: "typing:stop", ChannelId: "c", Timestamp: 1, JsonData: []byte(`{"userId":"u1","extra":1}`)},
+		},
+		{
+			name:    "other events keep their data as JSON",
+			payload: `{"type":"reaction:added","channelId":"c","timestamp":1,"seq":4,"data":{"messageId":"m1"},"excludeUserId":"u1"}`,
+			want:    Event{Type: "reaction:added", ChannelId: "c", Timestamp: 1, Seq: 4, JsonData: []byte(`{"messageId":"m1"}`), ExcludeUserId: "u1"},
+			same:    true,
+		},
+		{
+			name:    "no data",
+			payload: `{"type":"seq:skip","channelId":"c","timestamp":1,"seq":9,"data":null}`,
+			want:    Event{Type: "seq:skip", ChannelId: "c", Timestamp: 1, Seq: 9},
+			same:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EventFromJSON([]byte(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("EventFromJSON() = %+v, want %+v", *got, tt.want)
+			}
+
+			var decoded Event
+			if err := decoded.Unmarshal(got.Marshal()); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, tt.want) {
+				t.Errorf("round trip = %+v, want %+v", decoded, tt.want)
+			}
+
+			if tt.same {
+				out, err := decoded.JSON()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(out) != tt.payload {
+					t.Errorf("JSON() = %s, want %s", out, tt.payload)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package pb
+
+import (
+	"github.com/goccy/go-json"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Request is the gows.v2.Request message
+type Request struct {
+	Id   string
+	Type string
+
+	// Members of the data oneof, at most one is set
+	Typing      *TypingCommand
+	MessageSend *MessageSendCommand
+	ReadMark    *ReadMarkCommand
+	Thread      *ThreadCommand
+	Heartbeat   *HeartbeatCommand
+	Replay      *ReplayCommand
+	JsonData    []byte
+}
+
+type TypingCommand struct {
+	ThreadId string `json:"threadId,omitempty"`
+}
+
+type MessageSendCommand struct {
+	Content  string `json:"content"`
+	ImageUrl string `json:"imageUrl,omitempty"`
+	ThreadId string `json:"threadId,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+}
+
+type ReadMarkCommand struct {
+	MessageId string `json:"messageId"`
+	ThreadId  string `json:"threadId,omitempty"`
+}
+
+type ThreadCommand struct {
+	ThreadId string `json:"threadId"`
+}
+
+type HeartbeatCommand struct {
+	Seq int64 `json:"seq,omitempty"`
+	Ts  int64 `json:"ts,omitempty"`
+}
+
+type ReplayCommand struct {
+	FromSeq int64 `json:"fromSeq"`
+	ToSeq   int64 `json:"toSeq,omitempty"`
+}
+
+// JSON converts the request to the JSON shape clients send on text frames
+func (r *Request) JSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Id   string      `json:"id,omitempty"`
+		Type string      `json:"type"`
+		Data interface{} `json:"data,omitempty"`
+	}{
+		Id:   r.Id,
+		Type: r.Type,
+		Data: r.data(),
+	})
+}
+
+func (r *Request) data() interface{} {
+	switch {
+	case r.Typing != nil:
+		return r.Typing
+	case r.MessageSend != nil:
+		return r.MessageSend
+	case r.ReadMark != nil:
+		return r.ReadMark
+	case r.Thread != nil:
+		return r.Thread
+	case r.Heartbeat != nil:
+		return r.Heartbeat
+	case r.Replay != nil:
+		return r.Replay
+	case r.JsonData != nil:
+		return json.RawMessage(r.JsonData)
+	}
+	return nil
+}
+
+func (r *Request) clearData() {
+	r.Typing, r.MessageSend, r.ReadMark, r.Thread, r.Heartbeat, r.Replay, r.JsonData = nil, nil, nil, nil, nil, nil, nil
+}
+
+func (r *Request) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, r.Id)
+	b = appendString(b, 2, r.Type)
+
+	switch {
+	case r.Typing != nil:
+		b = appendBytes(b, 3, r.Typing.Marshal())
+	case r.MessageSend != nil:
+		b = appendBytes(b, 4, r.MessageSend.Marshal())
+	case r.ReadMark != nil:
+		b = appendBytes(b, 5, r.ReadMark.Marshal())
+	case r.Thread != nil:
+		b = appendBytes(b, 6, r.Thread.Marshal())
+	case r.Heartbeat != nil:
+		b = appendBytes(b, 7, r.Heartbeat.Marshal())
+	case r.Replay != nil:
+		b = appendBytes(b, 8, r.Replay.Marshal())
+	case r.JsonData != nil:
+		b = appendBytes(b, 15, r.JsonData)
+	}
+	return b
+}
+
+func (r *Request) Unmarshal(b []byte) error {
+	*r = Request{}
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &r.Id)
+		case 2:
+			return consumeString(typ, b, &r.Type)
+		case 3:
+			d := &TypingCommand{}
+			r.clearData()
+			r.Typing = d
+			return consumeMessage(typ, b, d.Unmarshal)
+		case 4:
+			d := &MessageSendCommand{}
+			r.clearData()
+			r.MessageSend = d
+			return consumeMessage(typ, b, d.Unmarshal)
+		case 5:
+			d := &ReadMarkCommand{}
+			r.clearData()
+			r.ReadMark = d
+			return consumeMessage(typ, b, d.Unmarshal)
+		case 6:
+			d := &ThreadCommand{}
+			r.clearData()
+			r.Thread = d
+			return consumeMessage(typ, b, d.Unmarshal)
+		case 7:
+			d := &HeartbeatCommand{}
+			r.clearData()
+			r.Heartbeat = d
+			return consumeMessage(typ, b, d.Unmarshal)
+		case 8:
+			d := &ReplayCommand{}
+			r.clearData()
+			r.Replay = d
+			return consumeMessage(typ, b, d.Unmarshal)
+		case 15:
+			r.clearData()
+			return consumeBytes(typ, b, &r.JsonData)
+		}
+		return 0, nil
+	})
+}
+
+func (d *TypingCommand) Marshal() []byte {
+	return appendString(nil, 1, d.ThreadId)
+}
+
+func (d *TypingCommand) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num == 1 {
+			return consumeString(typ, b, &d.ThreadId)
+		}
+		return 0, nil
+	})
+}
+
+func (d *MessageSendCommand) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, d.Content)
+	b = appendString(b, 2, d.ImageUrl)
+	b = appendString(b, 3, d.ThreadId)
+	b = appendString(b, 4, d.Nonce)
+	return b
+}
+
+func (d *MessageSendCommand) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &d.Content)
+		case 2:
+			return consumeString(typ, b, &d.ImageUrl)
+		case 3:
+			return consumeString(typ, b, &d.ThreadId)
+		case 4:
+			return consumeString(typ, b, &d.Nonce)
+		}
+		return 0, nil
+	})
+}
+
+func (d *ReadMarkCommand) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, d.MessageId)
+	b = appendString(b, 2, d.ThreadId)
+	return b
+}
+
+func (d *ReadMarkCommand) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &d.MessageId)
+		case 2:
+			return consumeString(typ, b, &d.ThreadId)
+		}
+		return 0, nil
+	})
+}
+
+func (d *ThreadCommand) Marshal() []byte {
+	return appendString(nil, 1, d.ThreadId)
+}
+
+func (d *ThreadCommand) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num == 1 {
+			return consumeString(typ, b, &d.ThreadId)
+		}
+		return 0, nil
+	})
+}
+
+func (d *HeartbeatCommand) Marshal() []byte {
+	var b []byte
+	b = appendInt64(b, 1, d.Seq)
+	b = appendInt64(b, 2, d.Ts)
+	return b
+}
+
+func (d *HeartbeatCommand) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeInt64(typ, b, &d.Seq)
+		case 2:
+			return consumeInt64(typ, b, &d.Ts)
+		}
+		return 0, nil
+	})
+}
+
+func (d *ReplayCommand) Marshal() []byte {
+	var b []byte
+	b = appendInt64(b, 1, d.FromSeq)
+	b = appendInt64(b, 2, d.ToSeq)
+	return b
+}
+
+func (d *ReplayCommand) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeInt64(typ, b, &d.FromSeq)
+		case 2:
+			return consumeInt64(typ, b, &d.ToSeq)
+		}
+		return 0, nil
+	})
+}
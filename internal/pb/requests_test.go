@@ -0,0 +1,114 @@
+package pb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRequestWire(t *testing.T) {
+	tests := []struct {
+		name    string
+		request Request
+		want    []byte
+		json    string
+	}{
+		{
+			name:    "typing",
+			request: Request{Id: "1", Type: "typing:start", Typing: &TypingCommand{ThreadId: "t1"}},
+			want:    concat(strField(1, "1"), strField(2, "typing:start"), msgField(3, strField(1, "t1"))),
+			json:    `{"id":"1","type":"typing:start","data":{"threadId":"t1"}}`,
+		},
+		{
+			name: "message_send",
+			request: Request{Id: "2", Type: "message:send", MessageSend: &MessageSendCommand{
+				Content: "hi", ImageUrl: "img", ThreadId: "t1", Nonce: "n1",
+			}},
+			want: concat(
+				strField(1, "2"), strField(2, "message:send"),
+				msgField(4, strField(1, "hi"), strField(2, "img"), strField(3, "t1"), strField(4, "n1")),
+			),
+			json: `{"id":"2","type":"message:send","data":{"content":"hi","imageUrl":"img","threadId":"t1","nonce":"n1"}}`,
+		},
+		{
+			name:    "read_mark",
+			request: Request{Type: "read:mark", ReadMark: &ReadMarkCommand{MessageId: "m1", ThreadId: "t1"}},
+			want:    concat(strField(2, "read:mark"), msgField(5, strField(1, "m1"), strField(2, "t1"))),
+			json:    `{"type":"read:mark","data":{"messageId":"m1","threadId":"t1"}}`,
+		},
+		{
+			name:    "thread",
+			request: Request{Type: "thread:subscribe", Thread: &ThreadCommand{ThreadId: "t1"}},
+			want:    concat(strField(2, "thread:subscribe"), msgField(6, strField(1, "t1"))),
+			json:    `{"type":"thread:subscribe","data":{"threadId":"t1"}}`,
+		},
+		{
+			name:    "heartbeat",
+			request: Request{Type: "pong", Heartbeat: &HeartbeatCommand{Seq: 5, Ts: 1700000000000}},
+			want:    concat(strField(2, "pong"), msgField(7, varintField(1, 5), varintField(2, 1700000000000))),
+			json:    `{"type":"pong","data":{"seq":5,"ts":1700000000000}}`,
+		},
+		{
+			name:    "replay",
+			request: Request{Id: "3", Type: "replay", Replay: &ReplayCommand{FromSeq: 10, ToSeq: 20}},
+			want:    concat(strField(1, "3"), strField(2, "replay"), msgField(8, varintField(1, 10), varintField(2, 20))),
+			json:    `{"id":"3","type":"replay","data":{"fromSeq":10,"toSeq":20}}`,
+		},
+		{
+			name:    "json_data",
+			request: Request{Type: "client:cursor", JsonData: []byte(`{"x":1}`)},
+			want:    concat(strField(2, "client:cursor"), strField(15, `{"x":1}`)),
+			json:    `{"type":"client:cursor","data":{"x":1}}`,
+		},
+		{
+			name:    "no data",
+			request: Request{Id: "4", Type: "unread:get"},
+			want:    concat(strField(1, "4"), strField(2, "unread:get")),
+			json:    `{"id":"4","type":"unread:get"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.request.Marshal(); !bytes.Equal(got, tt.want) {
+				t.Errorf("Marshal() = %x, want %x", got, tt.want)
+			}
+
+			var got Request
+			if err := got.Unmarshal(tt.want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.request) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.request)
+			}
+
+			out, err := got.JSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.json {
+				t.Errorf("JSON() = %s, want %s", out, tt.json)
+			}
+		})
+	}
+}
+
+func TestRequestUnmarshalSkipsUnknownFields(t *testing.T) {
+	payload := concat(
+		unknownFields(),
+		strField(1, "1"),
+		varintField(2, 1),
+		strField(2, "message:send"),
+		msgField(4, unknownFields(), strField(1, "hi"), varintField(4, 1)),
+		unknownFields(),
+	)
+	want := Request{Id: "1", Type: "message:send", MessageSend: &MessageSendCommand{Content: "hi"}}
+
+	var got Request
+	if err := got.Unmarshal(payload); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, want)
+	}
+}
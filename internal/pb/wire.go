@@ -0,0 +1,105 @@
+// Package pb encodes the messages of proto/events.proto and converts them to
+// and from the JSON events used everywhere else in the server.
+package pb
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// IsJSON reports whether a payload is a JSON object rather than a protobuf
+// message. A protobuf Event never starts with '{', the tag of a group. JSON
+// payloads must start with it too: leading whitespace isn't skipped, since
+// '\n' is also the tag of the type field.
+func IsJSON(payload []byte) bool {
+	return len(payload) > 0 && payload[0] == '{'
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendBytes always writes the field, since it is used for oneof members
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// fieldFunc decodes the value of one field from b and returns its length, or
+// 0 if the field is unknown and should be skipped
+type fieldFunc func(num protowire.Number, typ protowire.Type, b []byte) (int, error)
+
+func unmarshal(b []byte, field fieldFunc) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// Fields with an unexpected wire type are skipped like unknown fields
+
+func consumeString(typ protowire.Type, b []byte, v *string) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, nil
+	}
+	s, n := protowire.ConsumeString(b)
+	*v = s
+	return n, nil
+}
+
+func consumeInt64(typ protowire.Type, b []byte, v *int64) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, nil
+	}
+	x, n := protowire.ConsumeVarint(b)
+	*v = int64(x)
+	return n, nil
+}
+
+func consumeBytes(typ protowire.Type, b []byte, v *[]byte) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, nil
+	}
+	x, n := protowire.ConsumeBytes(b)
+	*v = append([]byte{}, x...)
+	return n, nil
+}
+
+// consumeMessage decodes an embedded message with its Unmarshal function
+func consumeMessage(typ protowire.Type, b []byte, unmarshal func([]byte) error) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, nil
+	}
+	x, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n, nil
+	}
+	return n, unmarshal(x)
+}
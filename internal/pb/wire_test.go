@@ -0,0 +1,92 @@
+package pb
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Builders for expected encodings, with field numbers from proto/events.proto
+
+func concat(fields ...[]byte) []byte {
+	var b []byte
+	for _, f := range fields {
+		b = append(b, f...)
+	}
+	return b
+}
+
+func strField(num protowire.Number, v string) []byte {
+	b := protowire.AppendTag(nil, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func varintField(num protowire.Number, v int64) []byte {
+	b := protowire.AppendTag(nil, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func msgField(num protowire.Number, fields ...[]byte) []byte {
+	b := protowire.AppendTag(nil, num, protowire.BytesType)
+	return protowire.AppendBytes(b, concat(fields...))
+}
+
+// unknownFields has a field of every wire type, numbered beyond any message
+func unknownFields() []byte {
+	b := varintField(100, 42)
+	b = append(b, strField(101, "unknown")...)
+	b = protowire.AppendTag(b, 102, protowire.Fixed32Type)
+	b = protowire.AppendFixed32(b, 7)
+	b = protowire.AppendTag(b, 103, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, 7)
+	b = protowire.AppendTag(b, 104, protowire.StartGroupType)
+	b = append(b, varintField(1, 1)...)
+	return protowire.AppendTag(b, 104, protowire.EndGroupType)
+}
+
+func TestIsJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{"JSON object", []byte(`{"type":"message:created"}`), true},
+		{"empty", nil, false},
+		{"leading whitespace", []byte("\n{\"type\":\"message:created\"}"), false},
+		// The tag of the type field is '\n' and its length '{'
+		{"event with a 123 byte type", (&Event{Type: strings.Repeat("x", 123), ChannelId: "c"}).Marshal(), false},
+		{"event with a 32 byte type", (&Event{Type: strings.Repeat("x", 32)}).Marshal(), false},
+		{"event without a type", (&Event{ChannelId: "c"}).Marshal(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsJSON(tt.payload); got != tt.want {
+				t.Errorf("IsJSON(%q) = %v, want %v", tt.payload, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"truncated string", []byte{0x0a, 0x05, 'a'}},
+		{"truncated varint", []byte{0x18, 0x80}},
+		{"truncated tag", []byte{0x80}},
+		{"truncated nested message", concat(strField(1, "t"), []byte{0x22, 0x03, 0x0a, 0x05})},
+		{"unterminated group", []byte{0x83, 0x06}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e Event
+			if err := e.Unmarshal(tt.payload); err == nil {
+				t.Errorf("Unmarshal(%x) succeeded: %+v", tt.payload, e)
+			}
+		})
+	}
+}
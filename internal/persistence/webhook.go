@@ -0,0 +1,73 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go-websocket/internal/models"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// Largest webhook response read, well above any stored message
+const maxResponseSize = 1 << 20
+
+// WebhookStore persists client messages by POSTing them to the backend, which
+// replies with the stored message including its id
+type WebhookStore struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookStore(url, secret string, timeout time.Duration) *WebhookStore {
+	return &WebhookStore{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *WebhookStore) SaveMessage(draft *models.MessageDraft) (*models.MessageCreatedData, error) {
+	body, err := json.Marshal(draft)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.secret != "" {
+		req.Header.Set("X-Webhook-Secret", s.secret)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		slog.Error("[PERSIST] Webhook request failed", "channel", draft.ChannelId, "error", err)
+		return nil, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+		slog.Error("[PERSIST] Webhook returned error status", "channel", draft.ChannelId, "status", resp.StatusCode)
+		return nil, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	var created models.MessageCreatedData
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&created); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook response: %w", err)
+	}
+
+	if created.ID == "" {
+		return nil, fmt.Errorf("webhook response has no message id")
+	}
+
+	return &created, nil
+}
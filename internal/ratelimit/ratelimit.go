@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Wildcard is the rule key used for events without a dedicated rule
+const Wildcard = "*"
+
+// Rule allows Limit events per Period, with bursts of up to Limit
+type Rule struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Rules maps event types to their rule
+type Rules map[string]Rule
+
+// Lookup returns the rule for an event type, falling back to the rule of its
+// namespace ("client:*") and then the wildcard rule. The key identifies the
+// bucket to use: all types of a namespace share one, and so do all types
+// matched by the wildcard, since clients choose the types they send and
+// would otherwise get a bucket for each.
+func (r Rules) Lookup(eventType string) (key string, rule Rule, ok bool) {
+	if rule, ok := r[eventType]; ok {
+		return eventType, rule, true
+	}
+	if ns, _, found := strings.Cut(eventType, ":"); found {
+		if rule, ok := r[ns+":*"]; ok {
+			return ns + ":*", rule, true
+		}
+	}
+	rule, ok = r[Wildcard]
+	return Wildcard, rule, ok
+}
+
+// ParseRules parses a comma separated list of "event=limit/period" entries,
+// e.g. "typing:start=5/1s,typing:stop=5/1s,*=30/1s"
+func ParseRules(spec string) (Rules, error) {
+	rules := Rules{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		eventType, value, ok := strings.Cut(entry, "=")
+		if !ok || eventType == "" {
+			return nil, fmt.Errorf("invalid rate limit rule %q", entry)
+		}
+
+		limitStr, periodStr, ok := strings.Cut(value, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit rule %q: expected limit/period", entry)
+		}
+
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid rate limit rule %q: bad limit", entry)
+		}
+
+		period, err := time.ParseDuration(periodStr)
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("invalid rate limit rule %q: bad period", entry)
+		}
+
+		rules[strings.TrimSpace(eventType)] = Rule{Limit: limit, Period: period}
+	}
+	return rules, nil
+}
+
+// Bucket is an in-memory token bucket
+type Bucket struct {
+	mu     sync.Mutex
+	rule   Rule
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(rule Rule) *Bucket {
+	return &Bucket{
+		rule:   rule,
+		tokens: float64(rule.Limit),
+		last:   time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket if one is available
+func (b *Bucket) Allow() bool {
+	return b.allowAt(time.Now())
+}
+
+func (b *Bucket) allowAt(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	elapsed := now.Sub(b.last)
+	b.last = now
+
+	b.tokens += elapsed.Seconds() * float64(b.rule.Limit) / b.rule.Period.Seconds()
+	if b.tokens > float64(b.rule.Limit) {
+		b.tokens = float64(b.rule.Limit)
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    Rules
+		wantErr bool
+	}{
+		{
+			name: "rules",
+			spec: "typing:start=5/1s, client:*=30/500ms ,*=20/1m",
+			want: Rules{
+				"typing:start": {Limit: 5, Period: time.Second},
+				"client:*":     {Limit: 30, Period: 500 * time.Millisecond},
+				"*":            {Limit: 20, Period: time.Minute},
+			},
+		},
+		{name: "empty", spec: "", want: Rules{}},
+		{name: "empty entries", spec: ",typing:start=5/1s,,", want: Rules{"typing:start": {Limit: 5, Period: time.Second}}},
+		{name: "later rules win", spec: "*=1/1s,*=2/1s", want: Rules{"*": {Limit: 2, Period: time.Second}}},
+		{name: "missing =", spec: "typing:start", wantErr: true},
+		{name: "missing event type", spec: "=5/1s", wantErr: true},
+		{name: "missing period", spec: "typing:start=5", wantErr: true},
+		{name: "limit not a number", spec: "typing:start=five/1s", wantErr: true},
+		{name: "zero limit", spec: "typing:start=0/1s", wantErr: true},
+		{name: "negative limit", spec: "typing:start=-1/1s", wantErr: true},
+		{name: "period without unit", spec: "typing:start=5/1", wantErr: true},
+		{name: "zero period", spec: "typing:start=5/0s", wantErr: true},
+		{name: "negative period", spec: "typing:start=5/-1s", wantErr: true},
+		{name: "one bad entry fails all", spec: "typing:start=5/1s,*=x/1s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRules(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseRules(%q) = %v, want an error", tt.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRules(%q) failed: %v", tt.spec, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRules(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesLookup(t *testing.T) {
+	exact := Rule{Limit: 1, Period: time.Second}
+	namespace := Rule{Limit: 2, Period: time.Second}
+	wildcard := Rule{Limit: 3, Period: time.Second}
+
+	tests := []struct {
+		name      string
+		rules     Rules
+		eventType string
+
+		wantKey  string
+		wantRule Rule
+		wantOk   bool
+	}{
+		{
+			name:      "exact rule",
+			rules:     Rules{"client:cursor": exact, "client:*": namespace, "*": wildcard},
+			eventType: "client:cursor",
+			wantKey:   "client:cursor", wantRule: exact, wantOk: true,
+		},
+		{
+			name:      "namespace before wildcard",
+			rules:     Rules{"client:*": namespace, "*": wildcard},
+			eventType: "client:viewing",
+			wantKey:   "client:*", wantRule: namespace, wantOk: true,
+		},
+		{
+			name:      "wildcard shares one key",
+			rules:     Rules{"client:*": namespace, "*": wildcard},
+			eventType: "typing:start",
+			wantKey:   "*", wantRule: wildcard, wantOk: true,
+		},
+		{
+			name:      "wildcard for types without a namespace",
+			rules:     Rules{"client:*": namespace, "*": wildcard},
+			eventType: "ping",
+			wantKey:   "*", wantRule: wildcard, wantOk: true,
+		},
+		{
+			name:      "namespace only matches its prefix",
+			rules:     Rules{"client:*": namespace},
+			eventType: "clientx:cursor",
+		},
+		{
+			name:      "no rule",
+			rules:     Rules{"typing:start": exact},
+			eventType: "typing:stop",
+		},
+		{
+			name:      "no rules",
+			eventType: "typing:stop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, rule, ok := tt.rules.Lookup(tt.eventType)
+			if ok != tt.wantOk {
+				t.Fatalf("Lookup(%q) ok = %v, want %v", tt.eventType, ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if key != tt.wantKey || rule != tt.wantRule {
+				t.Errorf("Lookup(%q) = %q, %v, want %q, %v", tt.eventType, key, rule, tt.wantKey, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestBucketRefill(t *testing.T) {
+	b := NewBucket(Rule{Limit: 4, Period: time.Second})
+	start := b.last
+
+	steps := []struct {
+		after time.Duration
+		want  bool
+	}{
+		// A full bucket allows a burst of Limit events
+		{0, true},
+		{0, true},
+		{0, true},
+		{0, true},
+		{0, false},
+		// One token comes back every Period/Limit
+		{100 * time.Millisecond, false},
+		{250 * time.Millisecond, true},
+		{250 * time.Millisecond, false},
+		{500 * time.Millisecond, true},
+		{500 * time.Millisecond, false},
+		// Refills stop at Limit
+		{10 * time.Second, true},
+		{10 * time.Second, true},
+		{10 * time.Second, true},
+		{10 * time.Second, true},
+		{10 * time.Second, false},
+	}
+
+	for i, step := range steps {
+		if got := b.allowAt(start.Add(step.after)); got != step.want {
+			t.Errorf("step %d at +%v: Allow() = %v, want %v", i, step.after, got, step.want)
+		}
+	}
+}
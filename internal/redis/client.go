@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"go-websocket/internal/models"
+	"go-websocket/internal/pb"
 	"log/slog"
 	"time"
 
@@ -10,9 +11,27 @@ import (
 	"github.com/goccy/go-json"
 )
 
+// PayloadFormat is the encoding of events published to Redis
+type PayloadFormat string
+
+const (
+	PayloadJSON PayloadFormat = "json"
+
+	// Protobuf gows.v2.Event messages, see proto/events.proto
+	PayloadProtobuf PayloadFormat = "protobuf"
+)
+
 type Client struct {
-	rdb *redis.Client
-	ctx context.Context
+	rdb    *redis.Client
+	ctx    context.Context
+	format PayloadFormat
+
+	// Channel history, see SetHistory
+	historyLen int
+	historyTTL time.Duration
+
+	// Messages waiting for the unread workers, see queueUnread
+	unread chan unreadJob
 }
 
 func NewClient(redisURL string) *Client {
@@ -33,10 +52,26 @@ func NewClient(redisURL string) *Client {
 
 	slog.Info("Connected to Redis")
 
-	return &Client{
-		rdb: rdb,
-		ctx: ctx,
+	c := &Client{
+		rdb:    rdb,
+		ctx:    ctx,
+		format: PayloadJSON,
+
+		historyLen: 1000,
+		historyTTL: 24 * time.Hour,
+
+		unread: make(chan unreadJob, unreadQueueSize),
 	}
+	for i := 0; i < unreadWorkers; i++ {
+		go c.runUnreadWorker()
+	}
+	return c
+}
+
+// SetPayloadFormat sets the encoding of published events. Subscribers accept
+// both formats, so nodes can be switched one at a time.
+func (c *Client) SetPayloadFormat(format PayloadFormat) {
+	c.format = format
 }
 
 func (c *Client) Close() error {
@@ -56,6 +91,50 @@ func (c *Client) PublishMessageCreated(channelId string, message interface{}) er
 	return c.publishEvent(channelId, event)
 }
 
+func (c *Client) PublishMessageUpdated(channelId string, message *models.MessageUpdatedData) error {
+	event := models.Event{
+		Type:      models.EventMessageUpdated,
+		ChannelId: channelId,
+		Timestamp: time.Now().Unix(),
+		Data:      message,
+	}
+
+	return c.publishEvent(channelId, event)
+}
+
+func (c *Client) PublishMessageDeleted(channelId string, message *models.MessageDeletedData) error {
+	event := models.Event{
+		Type:      models.EventMessageDeleted,
+		ChannelId: channelId,
+		Timestamp: time.Now().Unix(),
+		Data:      message,
+	}
+
+	return c.publishEvent(channelId, event)
+}
+
+func (c *Client) PublishReactionAdded(channelId string, reaction *models.ReactionData) error {
+	event := models.Event{
+		Type:      models.EventReactionAdded,
+		ChannelId: channelId,
+		Timestamp: time.Now().Unix(),
+		Data:      reaction,
+	}
+
+	return c.publishEvent(channelId, event)
+}
+
+func (c *Client) PublishReactionRemoved(channelId string, reaction *models.ReactionData) error {
+	event := models.Event{
+		Type:      models.EventReactionRemoved,
+		ChannelId: channelId,
+		Timestamp: time.Now().Unix(),
+		Data:      reaction,
+	}
+
+	return c.publishEvent(channelId, event)
+}
+
 func (c *Client) PublishTypingStart(channelId, userId, userName string, threadId *string) error {
 	data := map[string]interface{}{
 		"userId":   userId,
@@ -97,6 +176,20 @@ func (c *Client) PublishTypingStop(channelId, userId string, threadId *string) e
 	return c.publishEvent(channelId, event)
 }
 
+// PublishWhisper relays an ephemeral client event to the channel, skipping
+// the sender's connection. Whispers are never persisted.
+func (c *Client) PublishWhisper(channelId, eventType, senderConnectionId string, whisper *models.WhisperData) error {
+	event := models.Event{
+		Type:                eventType,
+		ChannelId:           channelId,
+		Timestamp:           time.Now().Unix(),
+		Data:                whisper,
+		ExcludeConnectionId: senderConnectionId,
+	}
+
+	return c.publishEvent(channelId, event)
+}
+
 func (c *Client) PublishPresenceJoin(channelId, userId, userName string) error {
 	event := models.Event{
 		Type:      "presence:join",
@@ -125,7 +218,11 @@ func (c *Client) PublishPresenceLeave(channelId, userId string) error {
 }
 
 func (c *Client) publishEvent(channelId string, event models.Event) error {
-	payload, err := json.Marshal(event)
+	if c.historyLen > 0 && !models.Ephemeral(event.Type) {
+		return c.publishSequenced(channelId, event)
+	}
+
+	payload, err := c.encodeEvent(event)
 	if err != nil {
 		slog.Error("[REDIS] Failed to marshal event", "type", event.Type, "channel", channelId, "error", err)
 		return err
@@ -140,3 +237,17 @@ func (c *Client) publishEvent(channelId string, event models.Event) error {
 
 	return nil
 }
+
+// encodeEvent marshals an event in the configured payload format
+func (c *Client) encodeEvent(event models.Event) ([]byte, error) {
+	payload, err := json.Marshal(event)
+	if err != nil || c.format != PayloadProtobuf {
+		return payload, err
+	}
+
+	e, err := pb.EventFromJSON(payload)
+	if err != nil {
+		return nil, err
+	}
+	return e.Marshal(), nil
+}
@@ -0,0 +1,122 @@
+package redis
+
+import (
+	"go-websocket/internal/models"
+	"go-websocket/internal/pb"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/goccy/go-json"
+)
+
+// Numbers an event with the next sequence of its channel, keeps it in the
+// channel's history and publishes it, all at once so that events are published
+// in sequence order. The event is ARGV[1] .. seq .. ARGV[2], with seq written
+// in decimal or, for protobuf payloads, as a varint.
+var publishSequencedScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+
+local encoded
+if ARGV[3] == 'varint' then
+	encoded = ''
+	local n = seq
+	while n >= 128 do
+		encoded = encoded .. string.char(n % 128 + 128)
+		n = math.floor(n / 128)
+	end
+	encoded = encoded .. string.char(n)
+else
+	encoded = string.format('%d', seq)
+end
+
+local event = ARGV[1] .. encoded .. ARGV[2]
+redis.call('ZADD', KEYS[2], seq, event)
+redis.call('ZREMRANGEBYRANK', KEYS[2], 0, -tonumber(ARGV[4]) - 1)
+if tonumber(ARGV[5]) > 0 then
+	redis.call('PEXPIRE', KEYS[2], ARGV[5])
+end
+redis.call('PUBLISH', ARGV[6], event)
+return seq
+`)
+
+// Keys of a channel's sequence counter and history, in the same cluster slot
+func seqKey(channelId string) string     { return "seq:{" + channelId + "}" }
+func historyKey(channelId string) string { return "history:{" + channelId + "}" }
+
+// SetHistory sets how many events are kept per channel for replay and for how
+// long after the last one; a ttl of 0 keeps it indefinitely. A maxLen of 0
+// disables sequence numbers.
+func (c *Client) SetHistory(maxLen int, ttl time.Duration) {
+	c.historyLen = maxLen
+	c.historyTTL = ttl
+}
+
+// publishSequenced publishes an event numbered with the channel's sequence
+func (c *Client) publishSequenced(channelId string, event models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("[REDIS] Failed to marshal event", "type", event.Type, "channel", channelId, "error", err)
+		return err
+	}
+
+	// {"seq":N, followed by the other fields
+	prefix, suffix, encoding := []byte(`{"seq":`), append([]byte(","), payload[1:]...), "decimal"
+	if c.format == PayloadProtobuf {
+		e, err := pb.EventFromJSON(payload)
+		if err != nil {
+			slog.Error("[REDIS] Failed to marshal event", "type", event.Type, "channel", channelId, "error", err)
+			return err
+		}
+		prefix, suffix, encoding = pb.AppendSeqTag(e.Marshal()), nil, "varint"
+	}
+
+	channel := "channel:" + channelId
+	err = publishSequencedScript.Run(c.ctx, c.rdb,
+		[]string{seqKey(channelId), historyKey(channelId)},
+		prefix, suffix, encoding, c.historyLen, c.historyTTL.Milliseconds(), channel,
+	).Err()
+	if err != nil {
+		slog.Error("[REDIS] Failed to publish event", "type", event.Type, "channel", channel, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetHistory returns up to limit events of a channel's history with a
+// sequence from fromSeq to toSeq, or to the latest if toSeq is 0
+func (c *Client) GetHistory(channelId string, fromSeq, toSeq int64, limit int) ([]*models.BroadcastMessage, error) {
+	max := "+inf"
+	if toSeq > 0 {
+		max = strconv.FormatInt(toSeq, 10)
+	}
+
+	payloads, err := c.rdb.ZRangeByScore(c.ctx, historyKey(channelId), &redis.ZRangeBy{
+		Min:   strconv.FormatInt(fromSeq, 10),
+		Max:   max,
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		slog.Error("[REDIS] Failed to read channel history", "channel", channelId, "error", err)
+		return nil, err
+	}
+
+	messages := make([]*models.BroadcastMessage, 0, len(payloads))
+	for _, stored := range payloads {
+		payload, err := decodePayload([]byte(stored))
+		if err != nil {
+			slog.Error("[REDIS] Error decoding protobuf event", "channel", channelId, "error", err)
+			continue
+		}
+
+		var event models.RawEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			slog.Error("[REDIS] Error unmarshaling event", "channel", channelId, "error", err)
+			continue
+		}
+		messages = append(messages, newBroadcast(payload, &event))
+	}
+	return messages, nil
+}
@@ -1,9 +1,12 @@
 package redis
 
 import (
+	"bytes"
 	"go-websocket/internal/models"
+	"go-websocket/internal/pb"
 	"go-websocket/internal/ws"
 	"log/slog"
+	"strings"
 
 	"github.com/goccy/go-json"
 )
@@ -11,11 +14,11 @@ import (
 func SubscribeToEvents(client *Client, hub *ws.Hub) {
 	slog.Info("[REDIS] Starting Redis pub/sub subscription...")
 
-	// Subscribe to all channel events using pattern
-	pubsub := client.rdb.PSubscribe(client.ctx, "channel:*")
+	// Subscribe to all channel and user events using patterns
+	pubsub := client.rdb.PSubscribe(client.ctx, "channel:*", "user:*")
 	defer pubsub.Close()
 
-	slog.Info("[REDIS] Subscribed to Redis pub/sub", "pattern", "channel:*")
+	slog.Info("[REDIS] Subscribed to Redis pub/sub", "patterns", []string{"channel:*", "user:*"})
 
 	// Wait for subscription confirmation
 	_, err := pubsub.Receive(client.ctx)
@@ -32,27 +35,176 @@ func SubscribeToEvents(client *Client, hub *ws.Hub) {
 	for msg := range ch {
 		// slog.Debug("[REDIS] Received message from Redis", "channel", msg.Channel, "size", len(msg.Payload))
 
-		var event models.Event
-		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+		payload, err := decodePayload([]byte(msg.Payload))
+		if err != nil {
+			slog.Error("[REDIS] Error decoding protobuf event", "channel", msg.Channel, "error", err, "size", len(msg.Payload))
+			continue
+		}
+
+		var event models.RawEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
 			slog.Error("[REDIS] Error unmarshaling event", "channel", msg.Channel, "error", err, "payload", msg.Payload)
 			continue
 		}
 
+		// Reject malformed events before they reach any client
+		if err := event.Validate(); err != nil {
+			slog.Warn("[REDIS] Dropping invalid event", "channel", msg.Channel, "type", event.Type, "error", err)
+			continue
+		}
+		// Events for a single user go to all of their connections
+		if userId, ok := strings.CutPrefix(msg.Channel, "user:"); ok {
+			hub.SendToUser(userId, payload)
+			continue
+		}
+
+		if msg.Channel != "channel:"+event.ChannelId {
+			slog.Warn("[REDIS] Dropping event published to the wrong channel", "channel", msg.Channel, "channelId", event.ChannelId)
+			continue
+		}
+
 		// slog.Debug("[REDIS] Event parsed successfully", "type", event.Type, "channelId", event.ChannelId, "timestamp", event.Timestamp)
 
-		// Convert to broadcast message
-		broadcastMsg := &models.BroadcastMessage{
-			ChannelId: event.ChannelId,
-			Payload:   []byte(msg.Payload),
+		broadcastMsg := newBroadcast(payload, &event)
+		if event.Type == models.EventMessageCreated {
+			client.queueUnread(event.ChannelId, event.Data)
 		}
 
 		// slog.Debug("[REDIS] Sending broadcast message to hub", "channelId", event.ChannelId)
 
 		// Send to hub for broadcasting to WebSocket clients
-		hub.Broadcast <- broadcastMsg
+		hub.Broadcast(broadcastMsg)
 
 		// slog.Debug("[REDIS] Broadcast message sent to hub successfully")
 	}
 
 	slog.Info("[REDIS] Redis pub/sub channel closed")
 }
+
+// newBroadcast converts a channel event, live or replayed from history, to a
+// broadcast message
+func newBroadcast(payload []byte, event *models.RawEvent) *models.BroadcastMessage {
+	msg := &models.BroadcastMessage{
+		ChannelId:           event.ChannelId,
+		Payload:             payload,
+		Type:                event.Type,
+		Key:                 coalesceKey(event),
+		Seq:                 event.Seq,
+		ExcludeConnectionId: event.ExcludeConnectionId,
+		ExcludeUserId:       event.ExcludeUserId,
+	}
+
+	if event.Type == models.EventMessageCreated {
+		splitNonce(msg)
+	}
+	scopeToThread(event, msg)
+	return msg
+}
+
+// decodePayload converts protobuf events to JSON, which is what the hub and
+// all JSON clients work with. JSON payloads are returned as is.
+func decodePayload(payload []byte) ([]byte, error) {
+	if pb.IsJSON(payload) {
+		return payload, nil
+	}
+
+	var event pb.Event
+	if err := event.Unmarshal(payload); err != nil {
+		return nil, err
+	}
+	return event.JSON()
+}
+
+// splitNonce keeps the client nonce of a message:created only in the payload
+// delivered to the author's connections
+func splitNonce(msg *models.BroadcastMessage) {
+	var event map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(msg.Payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&event); err != nil {
+		return
+	}
+
+	data, ok := event["data"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if _, ok := data["nonce"]; !ok {
+		return
+	}
+	authorId, _ := data["authorId"].(string)
+
+	delete(data, "nonce")
+	stripped, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("[REDIS] Failed to strip message nonce", "channel", msg.ChannelId, "error", err)
+		return
+	}
+
+	msg.UserId = authorId
+	msg.UserPayload = msg.Payload
+	msg.Payload = stripped
+}
+
+// coalesceKey identifies events that supersede each other: the typing state
+// of a user in a thread, and the presence of a user
+func coalesceKey(event *models.RawEvent) string {
+	var data struct {
+		UserId   string `json:"userId"`
+		ThreadId string `json:"threadId"`
+	}
+
+	switch event.Type {
+	case models.EventTypingStart, models.EventTypingStop:
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return ""
+		}
+		return "typing:" + data.UserId + ":" + data.ThreadId
+	case models.EventPresenceJoin, models.EventPresenceLeave:
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return ""
+		}
+		return "presence:" + data.UserId
+	}
+	return ""
+}
+
+// scopeToThread restricts events inside a thread to the connections viewing
+// it. New replies are summarized as thread:activity for everyone else.
+func scopeToThread(event *models.RawEvent, msg *models.BroadcastMessage) {
+	var data struct {
+		ThreadId string `json:"threadId"`
+	}
+	if err := json.Unmarshal(event.Data, &data); err != nil || data.ThreadId == "" {
+		return
+	}
+	msg.ThreadId = data.ThreadId
+
+	if event.Type != models.EventMessageCreated {
+		return
+	}
+
+	var message models.MessageCreatedData
+	if err := json.Unmarshal(event.Data, &message); err != nil {
+		return
+	}
+
+	activity, err := json.Marshal(models.Event{
+		Type:      models.EventThreadActivity,
+		ChannelId: event.ChannelId,
+		Timestamp: event.Timestamp,
+		Seq:       event.Seq,
+		Data: models.ThreadActivityData{
+			ThreadId:   message.ThreadId,
+			MessageId:  message.ID,
+			AuthorId:   message.AuthorId,
+			AuthorName: message.AuthorName,
+			CreatedAt:  message.CreatedAt,
+		},
+	})
+	if err != nil {
+		slog.Error("[REDIS] Failed to marshal thread:activity", "channel", event.ChannelId, "thread", data.ThreadId, "error", err)
+		return
+	}
+	msg.ActivityPayload = activity
+}
@@ -0,0 +1,146 @@
+package redis
+
+import (
+	"go-websocket/internal/models"
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-json"
+)
+
+// decode unmarshals a JSON payload for comparison, or returns nil for none
+func decode(t *testing.T, payload []byte) map[string]interface{} {
+	t.Helper()
+	if payload == nil {
+		return nil
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		t.Fatalf("invalid payload %s: %v", payload, err)
+	}
+	return v
+}
+
+func TestNewBroadcast(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+
+		want models.BroadcastMessage
+		// Payloads of the broadcast, compared as JSON
+		wantPayload, wantUserPayload, wantActivity string
+	}{
+		{
+			name:        "message without nonce",
+			payload:     `{"type":"message:created","channelId":"c","timestamp":1,"seq":4,"data":{"id":"m1","authorId":"u1","content":"hi"}}`,
+			want:        models.BroadcastMessage{Type: "message:created", ChannelId: "c", Seq: 4},
+			wantPayload: `{"type":"message:created","channelId":"c","timestamp":1,"seq":4,"data":{"id":"m1","authorId":"u1","content":"hi"}}`,
+		},
+		{
+			name:            "nonce only for the author",
+			payload:         `{"type":"message:created","channelId":"c","timestamp":1,"seq":4,"data":{"id":"m1","authorId":"u1","content":"hi","nonce":"n1"},"excludeConnectionId":"conn_1"}`,
+			want:            models.BroadcastMessage{Type: "message:created", ChannelId: "c", Seq: 4, UserId: "u1", ExcludeConnectionId: "conn_1"},
+			wantPayload:     `{"type":"message:created","channelId":"c","timestamp":1,"seq":4,"data":{"id":"m1","authorId":"u1","content":"hi"},"excludeConnectionId":"conn_1"}`,
+			wantUserPayload: `{"type":"message:created","channelId":"c","timestamp":1,"seq":4,"data":{"id":"m1","authorId":"u1","content":"hi","nonce":"n1"},"excludeConnectionId":"conn_1"}`,
+		},
+		{
+			name:        "nonce left alone on other events",
+			payload:     `{"type":"message:updated","channelId":"c","timestamp":1,"seq":5,"data":{"id":"m1","content":"edit","nonce":"n1"}}`,
+			want:        models.BroadcastMessage{Type: "message:updated", ChannelId: "c", Seq: 5},
+			wantPayload: `{"type":"message:updated","channelId":"c","timestamp":1,"seq":5,"data":{"id":"m1","content":"edit","nonce":"n1"}}`,
+		},
+		{
+			name:            "thread reply",
+			payload:         `{"type":"message:created","channelId":"c","timestamp":1,"seq":6,"data":{"id":"m2","authorId":"u1","authorName":"U","content":"re","threadId":"t1","createdAt":"now","nonce":"n2"}}`,
+			want:            models.BroadcastMessage{Type: "message:created", ChannelId: "c", Seq: 6, ThreadId: "t1", UserId: "u1"},
+			wantPayload:     `{"type":"message:created","channelId":"c","timestamp":1,"seq":6,"data":{"id":"m2","authorId":"u1","authorName":"U","content":"re","threadId":"t1","createdAt":"now"}}`,
+			wantUserPayload: `{"type":"message:created","channelId":"c","timestamp":1,"seq":6,"data":{"id":"m2","authorId":"u1","authorName":"U","content":"re","threadId":"t1","createdAt":"now","nonce":"n2"}}`,
+			wantActivity:    `{"type":"thread:activity","channelId":"c","timestamp":1,"seq":6,"data":{"threadId":"t1","messageId":"m2","authorId":"u1","authorName":"U","createdAt":"now"}}`,
+		},
+		{
+			name:        "other thread events are scoped without activity",
+			payload:     `{"type":"reaction:added","channelId":"c","timestamp":1,"seq":7,"data":{"messageId":"m2","emoji":"+1","userId":"u2","threadId":"t1"}}`,
+			want:        models.BroadcastMessage{Type: "reaction:added", ChannelId: "c", Seq: 7, ThreadId: "t1"},
+			wantPayload: `{"type":"reaction:added","channelId":"c","timestamp":1,"seq":7,"data":{"messageId":"m2","emoji":"+1","userId":"u2","threadId":"t1"}}`,
+		},
+		{
+			name:        "typing in a thread",
+			payload:     `{"type":"typing:start","channelId":"c","timestamp":1,"data":{"userId":"u1","threadId":"t1"},"excludeUserId":"u1"}`,
+			want:        models.BroadcastMessage{Type: "typing:start", ChannelId: "c", Key: "typing:u1:t1", ThreadId: "t1", ExcludeUserId: "u1"},
+			wantPayload: `{"type":"typing:start","channelId":"c","timestamp":1,"data":{"userId":"u1","threadId":"t1"},"excludeUserId":"u1"}`,
+		},
+		{
+			name:        "presence",
+			payload:     `{"type":"presence:leave","channelId":"c","timestamp":1,"data":{"userId":"u1"}}`,
+			want:        models.BroadcastMessage{Type: "presence:leave", ChannelId: "c", Key: "presence:u1"},
+			wantPayload: `{"type":"presence:leave","channelId":"c","timestamp":1,"data":{"userId":"u1"}}`,
+		},
+		{
+			name:        "whisper",
+			payload:     `{"type":"client:cursor","channelId":"c","timestamp":1,"data":{"userId":"u1","payload":{"threadId":"t1"}}}`,
+			want:        models.BroadcastMessage{Type: "client:cursor", ChannelId: "c"},
+			wantPayload: `{"type":"client:cursor","channelId":"c","timestamp":1,"data":{"userId":"u1","payload":{"threadId":"t1"}}}`,
+		},
+		{
+			name:        "unknown type without data",
+			payload:     `{"type":"poll:closed","channelId":"c","timestamp":1,"seq":8}`,
+			want:        models.BroadcastMessage{Type: "poll:closed", ChannelId: "c", Seq: 8},
+			wantPayload: `{"type":"poll:closed","channelId":"c","timestamp":1,"seq":8}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var event models.RawEvent
+			if err := json.Unmarshal([]byte(tt.payload), &event); err != nil {
+				t.Fatal(err)
+			}
+			msg := newBroadcast([]byte(tt.payload), &event)
+
+			payloads := []struct {
+				name      string
+				got, want []byte
+			}{
+				{"Payload", msg.Payload, []byte(tt.wantPayload)},
+				{"UserPayload", msg.UserPayload, []byte(tt.wantUserPayload)},
+				{"ActivityPayload", msg.ActivityPayload, []byte(tt.wantActivity)},
+			}
+			for _, p := range payloads {
+				if len(p.want) == 0 {
+					p.want = nil
+				}
+				if got, want := decode(t, p.got), decode(t, p.want); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %s, want %s", p.name, p.got, p.want)
+				}
+			}
+
+			msg.Payload, msg.UserPayload, msg.ActivityPayload = nil, nil, nil
+			if !reflect.DeepEqual(*msg, tt.want) {
+				t.Errorf("newBroadcast() = %+v, want %+v", *msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+	tests := []struct {
+		eventType string
+		data      string
+		want      string
+	}{
+		{models.EventTypingStart, `{"userId":"u1"}`, "typing:u1:"},
+		{models.EventTypingStop, `{"userId":"u1","threadId":"t1"}`, "typing:u1:t1"},
+		{models.EventPresenceJoin, `{"userId":"u1","threadId":"t1"}`, "presence:u1"},
+		{models.EventPresenceLeave, `{"userId":"u1"}`, "presence:u1"},
+		{models.EventTypingStart, `"u1"`, ""},
+		{models.EventMessageCreated, `{"userId":"u1"}`, ""},
+		{"client:cursor", `{"userId":"u1"}`, ""},
+	}
+
+	for _, tt := range tests {
+		event := &models.RawEvent{Type: tt.eventType, Data: []byte(tt.data)}
+		if got := coalesceKey(event); got != tt.want {
+			t.Errorf("coalesceKey(%s %s) = %q, want %q", tt.eventType, tt.data, got, tt.want)
+		}
+	}
+}
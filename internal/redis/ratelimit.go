@@ -0,0 +1,44 @@
+package redis
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Token bucket shared by every node. Tokens refill continuously at
+// limit/period and the key expires once the bucket would be full again.
+var allowRateScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or limit
+local ts = tonumber(state[2]) or now
+
+tokens = math.min(limit, tokens + math.max(0, now - ts) * limit / period)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], period)
+return allowed
+`)
+
+// AllowRate takes a token from the cluster-wide bucket identified by key
+func (c *Client) AllowRate(key string, limit int, period time.Duration) (bool, error) {
+	allowed, err := allowRateScript.Run(c.ctx, c.rdb, []string{"ratelimit:" + key}, limit, period.Milliseconds()).Int()
+	if err != nil {
+		slog.Error("[REDIS] Failed to evaluate rate limit", "key", key, "error", err)
+		return false, err
+	}
+
+	return allowed == 1, nil
+}
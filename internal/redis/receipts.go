@@ -0,0 +1,234 @@
+package redis
+
+import (
+	"go-websocket/internal/models"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/goccy/go-json"
+)
+
+const (
+	// How long the channel and author of a message are remembered, for
+	// read:mark to check and author-only read receipts
+	messageInfoTTL = 30 * 24 * time.Hour
+
+	// How long a message:created is remembered as counted
+	unreadClaimTTL = time.Hour
+
+	// Members added by the server are dropped after this long without
+	// connecting to the channel
+	channelMemberTTL = 30 * 24 * time.Hour
+
+	// Goroutines counting unread messages, and the messages they can queue
+	unreadWorkers   = 4
+	unreadQueueSize = 1024
+)
+
+type unreadJob struct {
+	channelId string
+	data      json.RawMessage
+}
+
+// AddChannelMember records that a user belongs to a channel, so they get
+// unread counts for it. When the user was last seen is kept next to the
+// member set, which backends may also maintain, so stale members can be
+// trimmed.
+func (c *Client) AddChannelMember(channelId, userId string) error {
+	_, err := c.rdb.Pipelined(c.ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(c.ctx, "members:"+channelId, userId)
+		pipe.ZAdd(c.ctx, "members:seen:"+channelId, &redis.Z{Score: float64(time.Now().Unix()), Member: userId})
+		return nil
+	})
+	return err
+}
+
+// trimChannelMembers removes the members the server added that haven't
+// connected to the channel for channelMemberTTL
+func (c *Client) trimChannelMembers(channelId string) error {
+	seenKey := "members:seen:" + channelId
+	cutoff := strconv.FormatInt(time.Now().Add(-channelMemberTTL).Unix(), 10)
+
+	stale, err := c.rdb.ZRangeByScore(c.ctx, seenKey, &redis.ZRangeBy{Min: "-inf", Max: cutoff}).Result()
+	if err != nil || len(stale) == 0 {
+		return err
+	}
+
+	members := make([]interface{}, len(stale))
+	for i, userId := range stale {
+		members[i] = userId
+	}
+	_, err = c.rdb.Pipelined(c.ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(c.ctx, "members:"+channelId, members...)
+		pipe.ZRem(c.ctx, seenKey, members...)
+		return nil
+	})
+	return err
+}
+
+// SetReadCursor stores the last message a user read in a channel and resets
+// their unread count for it
+func (c *Client) SetReadCursor(channelId, userId, messageId string) error {
+	_, err := c.rdb.TxPipelined(c.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(c.ctx, "read:"+channelId, userId, messageId)
+		pipe.HSet(c.ctx, "unread:"+userId, channelId, 0)
+		return nil
+	})
+	if err != nil {
+		slog.Error("[REDIS] Failed to set read cursor", "channel", channelId, "user", userId, "error", err)
+	}
+	return err
+}
+
+// GetMessage returns the channel and author of a recent message, or "" for
+// both if unknown
+func (c *Client) GetMessage(messageId string) (channelId, authorId string, err error) {
+	values, err := c.rdb.HMGet(c.ctx, "msg:"+messageId, "channel", "author").Result()
+	if err != nil {
+		return "", "", err
+	}
+	channelId, _ = values[0].(string)
+	authorId, _ = values[1].(string)
+	return channelId, authorId, nil
+}
+
+// GetUnreadCounts returns the unread count of each of the user's channels
+func (c *Client) GetUnreadCounts(userId string) (map[string]int64, error) {
+	values, err := c.rdb.HGetAll(c.ctx, "unread:"+userId).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(values))
+	for channelId, value := range values {
+		count, _ := strconv.ParseInt(value, 10, 64)
+		counts[channelId] = count
+	}
+	return counts, nil
+}
+
+// PublishReadUpdated broadcasts a read receipt to the channel, or only to
+// toUserId's connections if set
+func (c *Client) PublishReadUpdated(channelId string, receipt *models.ReadReceiptData, toUserId string) error {
+	event := models.Event{
+		Type:      models.EventReadUpdated,
+		ChannelId: channelId,
+		Timestamp: time.Now().Unix(),
+		Data:      receipt,
+	}
+
+	if toUserId != "" {
+		return c.publishUserEvent(toUserId, event)
+	}
+	return c.publishEvent(channelId, event)
+}
+
+func (c *Client) PublishUnreadUpdated(userId, channelId string, count int64) error {
+	event := models.Event{
+		Type:      models.EventUnreadUpdated,
+		ChannelId: channelId,
+		Timestamp: time.Now().Unix(),
+		Data: models.UnreadData{
+			ChannelId: channelId,
+			Count:     count,
+		},
+	}
+
+	return c.publishUserEvent(userId, event)
+}
+
+// queueUnread hands a message:created to the unread workers without
+// blocking. If they are behind, the message is left to the other nodes, which
+// all receive it; it goes uncounted if every node is behind.
+func (c *Client) queueUnread(channelId string, data json.RawMessage) {
+	select {
+	case c.unread <- unreadJob{channelId: channelId, data: data}:
+	default:
+		slog.Warn("[REDIS] Unread queue full, leaving message to other nodes", "channel", channelId)
+	}
+}
+
+func (c *Client) runUnreadWorker() {
+	for job := range c.unread {
+		c.countUnread(job.channelId, job.data)
+	}
+}
+
+// countUnread records the author of a new message and pushes updated unread
+// counts to the other members of the channel
+func (c *Client) countUnread(channelId string, data json.RawMessage) {
+	var message models.MessageCreatedData
+	if err := json.Unmarshal(data, &message); err != nil {
+		return
+	}
+
+	// Every node receives the message; the first to claim it does the work
+	claimed, err := c.rdb.SetNX(c.ctx, "unread:claimed:"+message.ID, "1", unreadClaimTTL).Result()
+	if err != nil {
+		slog.Error("[REDIS] Failed to claim unread count", "channel", channelId, "message", message.ID, "error", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	_, err = c.rdb.TxPipelined(c.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(c.ctx, "msg:"+message.ID, "channel", channelId, "author", message.AuthorId)
+		pipe.Expire(c.ctx, "msg:"+message.ID, messageInfoTTL)
+		return nil
+	})
+	if err != nil {
+		slog.Error("[REDIS] Failed to record message", "message", message.ID, "error", err)
+	}
+
+	if err := c.trimChannelMembers(channelId); err != nil {
+		slog.Error("[REDIS] Failed to trim channel members", "channel", channelId, "error", err)
+	}
+
+	members, err := c.rdb.SMembers(c.ctx, "members:"+channelId).Result()
+	if err != nil {
+		slog.Error("[REDIS] Failed to get channel members", "channel", channelId, "error", err)
+		return
+	}
+
+	// One key per member, so the increments are separate commands rather
+	// than a script, which could only touch keys it is passed
+	var userIds []string
+	var counts []*redis.IntCmd
+	_, err = c.rdb.Pipelined(c.ctx, func(pipe redis.Pipeliner) error {
+		for _, userId := range members {
+			if userId != message.AuthorId {
+				userIds = append(userIds, userId)
+				counts = append(counts, pipe.HIncrBy(c.ctx, "unread:"+userId, channelId, 1))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("[REDIS] Failed to count unread messages", "channel", channelId, "message", message.ID, "error", err)
+		return
+	}
+
+	for i, userId := range userIds {
+		c.PublishUnreadUpdated(userId, channelId, counts[i].Val())
+	}
+}
+
+// publishUserEvent sends an event to every connection of a user, on any node
+func (c *Client) publishUserEvent(userId string, event models.Event) error {
+	payload, err := c.encodeEvent(event)
+	if err != nil {
+		slog.Error("[REDIS] Failed to marshal event", "type", event.Type, "user", userId, "error", err)
+		return err
+	}
+
+	channel := "user:" + userId
+	if err := c.rdb.Publish(c.ctx, channel, payload).Err(); err != nil {
+		slog.Error("[REDIS] Failed to publish event", "type", event.Type, "channel", channel, "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"go-websocket/internal/models"
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/goccy/go-json"
+)
+
+// StreamStore persists client messages by appending them to a Redis Stream
+// consumed by the backend. Message ids are assigned here.
+type StreamStore struct {
+	client *Client
+	stream string
+	maxLen int64
+}
+
+func NewStreamStore(client *Client, stream string, maxLen int64) *StreamStore {
+	return &StreamStore{
+		client: client,
+		stream: stream,
+		maxLen: maxLen,
+	}
+}
+
+func (s *StreamStore) SaveMessage(draft *models.MessageDraft) (*models.MessageCreatedData, error) {
+	created := &models.MessageCreatedData{
+		ID:           newMessageId(),
+		Content:      draft.Content,
+		ImageUrl:     draft.ImageUrl,
+		AuthorId:     draft.AuthorId,
+		AuthorName:   draft.AuthorName,
+		AuthorEmail:  draft.AuthorEmail,
+		AuthorAvatar: draft.AuthorAvatar,
+		CreatedAt:    time.Now().UTC().Format(time.RFC3339Nano),
+		ThreadId:     draft.ThreadId,
+	}
+
+	payload, err := json.Marshal(created)
+	if err != nil {
+		return nil, err
+	}
+
+	args := &redis.XAddArgs{
+		Stream: s.stream,
+		Values: map[string]interface{}{
+			"id":        created.ID,
+			"channelId": draft.ChannelId,
+			"threadId":  draft.ThreadId,
+			"message":   payload,
+		},
+	}
+	if s.maxLen > 0 {
+		args.MaxLen = s.maxLen
+		args.Approx = true
+	}
+
+	if err := s.client.rdb.XAdd(s.client.ctx, args).Err(); err != nil {
+		slog.Error("[REDIS] Failed to append message to stream", "stream", s.stream, "channel", draft.ChannelId, "error", err)
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func newMessageId() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "msg_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,184 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/internal/metrics"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AdmissionOptions struct {
+	// Maximum concurrent connections, 0 means unlimited
+	MaxConnsPerUser int
+	MaxConnsPerIP   int
+	MaxConnsPerNode int
+
+	// Proxies whose X-Forwarded-For header is trusted to carry the client IP
+	TrustedProxies []*net.IPNet
+
+	// Value of the Retry-After header on rejected connections
+	RetryAfter time.Duration
+}
+
+var (
+	connectionsGauge = metrics.NewGauge("ws_connections", "Open WebSocket connections on this node")
+	admissionUsers   = metrics.NewGauge("ws_admission_users", "Distinct users with open connections on this node")
+	admissionIPs     = metrics.NewGauge("ws_admission_ips", "Distinct client IPs with open connections on this node")
+	admissionReject  = metrics.NewCounterVec("ws_admission_rejected_total", "Connections rejected by admission limits", "reason")
+)
+
+// admission counts open connections per user, per IP and per node
+type admission struct {
+	mu      sync.Mutex
+	opts    AdmissionOptions
+	perUser map[string]int
+	perIP   map[string]int
+	total   int
+}
+
+func newAdmission(opts AdmissionOptions) *admission {
+	return &admission{
+		opts:    opts,
+		perUser: make(map[string]int),
+		perIP:   make(map[string]int),
+	}
+}
+
+// acquire reserves a connection slot. On success it returns a release func
+// that must be called exactly once when the connection goes away; otherwise
+// it returns the name of the exceeded limit.
+func (a *admission) acquire(userId, ip string) (release func(), reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case a.opts.MaxConnsPerNode > 0 && a.total >= a.opts.MaxConnsPerNode:
+		return nil, "node"
+	case a.opts.MaxConnsPerUser > 0 && a.perUser[userId] >= a.opts.MaxConnsPerUser:
+		return nil, "user"
+	case a.opts.MaxConnsPerIP > 0 && a.perIP[ip] >= a.opts.MaxConnsPerIP:
+		return nil, "ip"
+	}
+
+	a.total++
+	a.perUser[userId]++
+	a.perIP[ip]++
+	a.updateGauges()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { a.release(userId, ip) })
+	}, ""
+}
+
+func (a *admission) release(userId, ip string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.total--
+	if a.perUser[userId]--; a.perUser[userId] <= 0 {
+		delete(a.perUser, userId)
+	}
+	if a.perIP[ip]--; a.perIP[ip] <= 0 {
+		delete(a.perIP, ip)
+	}
+	a.updateGauges()
+}
+
+func (a *admission) updateGauges() {
+	connectionsGauge.Set(int64(a.total))
+	admissionUsers.Set(int64(len(a.perUser)))
+	admissionIPs.Set(int64(len(a.perIP)))
+}
+
+// reject answers a connection attempt that exceeded an admission limit
+func (a *admission) reject(w http.ResponseWriter, reason string) {
+	admissionReject.Inc(reason)
+
+	retryAfter := int(a.opts.RetryAfter.Seconds())
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", fmt.Sprint(retryAfter))
+	http.Error(w, "Too many connections ("+reason+" limit reached)", http.StatusTooManyRequests)
+}
+
+// clientIP resolves the remote IP of a request, following X-Forwarded-For
+// only through trusted proxies
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrusted(host, trusted) {
+		return host
+	}
+
+	// Walk the chain right to left; the first hop we don't trust is the client
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !isTrusted(hops[i], trusted) {
+			return hops[i]
+		}
+	}
+
+	if len(hops) > 0 {
+		return hops[0]
+	}
+	return host
+}
+
+func isTrusted(host string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma separated list of CIDRs or bare IPs
+func ParseTrustedProxies(spec string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
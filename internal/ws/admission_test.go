@@ -0,0 +1,192 @@
+package ws
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		// X-Forwarded-For headers, in order
+		xff  []string
+		want string
+	}{
+		{
+			name:       "no proxy",
+			remoteAddr: "203.0.113.7:5000",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "spoofed header from an untrusted peer",
+			remoteAddr: "203.0.113.7:5000",
+			xff:        []string{"198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.2:5000",
+			xff:        []string{"203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy without the header",
+			remoteAddr: "10.0.0.2:5000",
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.0.0.2:5000",
+			xff:        []string{"203.0.113.7, 192.168.1.1, 10.1.2.3"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "client prepends a spoofed hop",
+			remoteAddr: "10.0.0.2:5000",
+			xff:        []string{"198.51.100.1, 203.0.113.7, 10.1.2.3"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "client prepends a trusted looking hop",
+			remoteAddr: "10.0.0.2:5000",
+			xff:        []string{"10.9.9.9, 203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "chain split across headers",
+			remoteAddr: "10.0.0.2:5000",
+			xff:        []string{"198.51.100.1, 203.0.113.7", "10.1.2.3"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "every hop trusted",
+			remoteAddr: "10.0.0.2:5000",
+			xff:        []string{"10.1.1.1, 10.2.2.2"},
+			want:       "10.1.1.1",
+		},
+		{
+			name:       "garbage hop is not trusted",
+			remoteAddr: "10.0.0.2:5000",
+			xff:        []string{"203.0.113.7, not-an-ip, 10.1.2.3"},
+			want:       "not-an-ip",
+		},
+		{
+			name:       "empty hops are skipped",
+			remoteAddr: "10.0.0.2:5000",
+			xff:        []string{" , 203.0.113.7,, "},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "IPv6 proxy",
+			remoteAddr: "[::1]:5000",
+			xff:        []string{"2001:db8::7"},
+			want:       "2001:db8::7",
+		},
+		{
+			name:       "trusted bare IP only matches itself",
+			remoteAddr: "192.168.1.2:5000",
+			xff:        []string{"203.0.113.7"},
+			want:       "192.168.1.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, header := range tt.xff {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if got := clientIP(r, trusted); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "10.0.0.0/8", want: []string{"10.0.0.0/8"}},
+		{spec: " 192.168.1.1 , ::1,", want: []string{"192.168.1.1/32", "::1/128"}},
+		{spec: "10.0.0.1/8", want: []string{"10.0.0.0/8"}},
+		{spec: "proxy.local", wantErr: true},
+		{spec: "10.0.0.0/33", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			networks, err := ParseTrustedProxies(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseTrustedProxies(%q) = %v, want an error", tt.spec, networks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, network := range networks {
+				got = append(got, network.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseTrustedProxies(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	a := newAdmission(AdmissionOptions{MaxConnsPerUser: 2, MaxConnsPerIP: 3, MaxConnsPerNode: 4})
+
+	steps := []struct {
+		user, ip string
+		// Exceeded limit, or "" if admitted
+		want string
+	}{
+		{"u1", "ip1", ""},
+		{"u1", "ip1", ""},
+		{"u1", "ip2", "user"},
+		{"u2", "ip1", ""},
+		{"u3", "ip1", "ip"},
+		{"u3", "ip2", ""},
+		{"u4", "ip3", "node"},
+	}
+
+	var releases []func()
+	for i, step := range steps {
+		release, reason := a.acquire(step.user, step.ip)
+		if reason != step.want {
+			t.Fatalf("step %d: acquire(%s, %s) = %q, want %q", i, step.user, step.ip, reason, step.want)
+		}
+		if release != nil {
+			releases = append(releases, release)
+		}
+	}
+
+	// Releasing twice only frees one slot
+	releases[0]()
+	releases[0]()
+	if _, reason := a.acquire("u4", "ip3"); reason != "" {
+		t.Errorf("acquire after release = %q", reason)
+	}
+	if _, reason := a.acquire("u5", "ip3"); reason != "node" {
+		t.Errorf("acquire beyond the node limit = %q", reason)
+	}
+	if a.perUser["u1"] != 1 || a.perIP["ip1"] != 2 {
+		t.Errorf("counts after release: user %d, ip %d", a.perUser["u1"], a.perIP["ip1"])
+	}
+}
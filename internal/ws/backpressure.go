@@ -0,0 +1,259 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/internal/metrics"
+	"go-websocket/internal/models"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Frames queued for a client before its backpressure policy applies
+const sendQueueSize = 256
+
+// BackpressurePolicy decides what happens when a broadcast finds a client's
+// queue full
+type BackpressurePolicy string
+
+const (
+	// Close the connection with CloseSlowConsumer
+	BackpressureDisconnect BackpressurePolicy = "disconnect"
+
+	// Drop the oldest queued frame to make room
+	BackpressureDropOldest BackpressurePolicy = "drop-oldest"
+
+	// Drop the new frame
+	BackpressureDropNewest BackpressurePolicy = "drop-newest"
+
+	// Replace a queued frame with the same key (e.g. the typing state of a
+	// user), even before the queue is full; otherwise like drop-oldest
+	BackpressureCoalesce BackpressurePolicy = "coalesce"
+)
+
+// BackpressureRule applies a policy to the channels matching Pattern, a glob
+// such as "lobby-*"
+type BackpressureRule struct {
+	Pattern string
+	Policy  BackpressurePolicy
+}
+
+type BackpressureOptions struct {
+	// Policy of channels matching no rule; disconnect if empty
+	Default BackpressurePolicy
+
+	// Checked in order, the first matching rule wins
+	Rules []BackpressureRule
+}
+
+// policy returns the policy of a channel
+func (o BackpressureOptions) policy(channelId string) BackpressurePolicy {
+	for _, rule := range o.Rules {
+		if ok, _ := path.Match(rule.Pattern, channelId); ok {
+			return rule.Policy
+		}
+	}
+	if o.Default == "" {
+		return BackpressureDisconnect
+	}
+	return o.Default
+}
+
+// ValidBackpressurePolicy reports whether p is one of the policies above
+func ValidBackpressurePolicy(p BackpressurePolicy) bool {
+	switch p {
+	case BackpressureDisconnect, BackpressureDropOldest, BackpressureDropNewest, BackpressureCoalesce:
+		return true
+	}
+	return false
+}
+
+// ParseBackpressureRules parses a comma separated list of "pattern=policy"
+// entries, e.g. "lobby-*=drop-oldest,live-*=coalesce"
+func ParseBackpressureRules(spec string) ([]BackpressureRule, error) {
+	var rules []BackpressureRule
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, policy, ok := strings.Cut(entry, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid backpressure rule %q", entry)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid backpressure rule %q: %w", entry, err)
+		}
+
+		rule := BackpressureRule{Pattern: pattern, Policy: BackpressurePolicy(strings.TrimSpace(policy))}
+		if !ValidBackpressurePolicy(rule.Policy) {
+			return nil, fmt.Errorf("invalid backpressure rule %q: unknown policy", entry)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// priority orders frames when one has to give way. High priority frames are
+// never dropped: a client that can't take them is disconnected instead.
+type priority int8
+
+const (
+	// Superseded by later events or only relevant for a moment
+	priorityLow priority = iota
+	priorityNormal
+	// Content the client can't do without
+	priorityHigh
+)
+
+func eventPriority(eventType string) priority {
+	switch {
+	case eventType == models.EventMessageCreated, eventType == models.EventMessageUpdated, eventType == models.EventMessageDeleted:
+		return priorityHigh
+	case models.Ephemeral(eventType):
+		return priorityLow
+	}
+	return priorityNormal
+}
+
+var backpressureFrames = metrics.NewCounterVec(
+	"ws_backpressure_frames_total",
+	"Frames discarded by backpressure policies, by action",
+	"action",
+)
+
+type pushResult int
+
+const (
+	pushQueued pushResult = iota
+	// A queued frame with the same key was replaced
+	pushCoalesced
+	// A queued frame was dropped to make room
+	pushDroppedQueued
+	// The new frame was dropped
+	pushDroppedNew
+	// Nothing could give way; the client should be disconnected
+	pushOverflow
+)
+
+// sendQueue holds the frames waiting for a client's WritePump. Unlike a
+// channel, it lets queued frames be replaced or dropped.
+type sendQueue struct {
+	mu     sync.Mutex
+	frames []outbound
+
+	// Signaled when frames are queued; WritePump is the only receiver
+	ready chan struct{}
+
+	// Called instead for event loop connections, which have no WritePump
+	wake func()
+}
+
+func newSendQueue(wake func()) *sendQueue {
+	if wake != nil {
+		return &sendQueue{wake: wake}
+	}
+	return &sendQueue{ready: make(chan struct{}, 1)}
+}
+
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.frames)
+}
+
+// push queues a frame, applying policy if the queue is full
+func (q *sendQueue) push(frame outbound, policy BackpressurePolicy) pushResult {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if policy == BackpressureCoalesce && frame.key != "" {
+		for i := range q.frames {
+			if q.frames[i].key == frame.key {
+				q.frames[i] = frame
+				backpressureFrames.Inc("coalesced")
+				return pushCoalesced
+			}
+		}
+	}
+
+	result := pushQueued
+	if len(q.frames) >= sendQueueSize {
+		if policy == BackpressureDisconnect {
+			return pushOverflow
+		}
+
+		victim := q.victim(frame.priority, policy)
+		if victim < 0 {
+			if frame.priority == priorityHigh {
+				return pushOverflow
+			}
+			backpressureFrames.Inc("dropped_new")
+			return pushDroppedNew
+		}
+
+		q.frames = append(q.frames[:victim], q.frames[victim+1:]...)
+		backpressureFrames.Inc("dropped_queued")
+		result = pushDroppedQueued
+	}
+
+	q.frames = append(q.frames, frame)
+	q.signal()
+	return result
+}
+
+// victim returns the queued frame to drop for a new frame of priority p, or
+// -1: the oldest frame of the lowest priority, if that is below p, or equal
+// to p for policies dropping old frames. High priority frames are never
+// victims.
+func (q *sendQueue) victim(p priority, policy BackpressurePolicy) int {
+	victim := 0
+	for i := range q.frames {
+		if q.frames[i].priority < q.frames[victim].priority {
+			victim = i
+		}
+	}
+
+	switch lowest := q.frames[victim].priority; {
+	case lowest < p:
+		return victim
+	case lowest == p && p != priorityHigh && policy != BackpressureDropNewest:
+		return victim
+	}
+	return -1
+}
+
+// pop moves up to limit frames into buf, oldest first
+func (q *sendQueue) pop(buf []outbound, limit int) []outbound {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := min(len(q.frames), limit)
+	buf = append(buf[:0], q.frames[:n]...)
+
+	rest := copy(q.frames, q.frames[n:])
+	clear(q.frames[rest:])
+	q.frames = q.frames[:rest]
+
+	if rest > 0 {
+		q.signal()
+	} else if cap(q.frames) > 16 {
+		// Bursts are rare; don't keep their buffer around on idle connections
+		q.frames = nil
+	}
+	return buf
+}
+
+func (q *sendQueue) signal() {
+	if q.wake != nil {
+		q.wake()
+		return
+	}
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,238 @@
+package ws
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func testFrame(label string, p priority, key string) outbound {
+	return outbound{data: []byte(label), priority: p, key: key}
+}
+
+func labels(frames []outbound) []string {
+	out := make([]string, len(frames))
+	for i, f := range frames {
+		out[i] = string(f.data)
+	}
+	return out
+}
+
+// fillSendQueue queues frames, then normal priority frames "f<i>" until the
+// queue holds n
+func fillSendQueue(q *sendQueue, frames []outbound, n int) {
+	q.frames = append(q.frames, frames...)
+	for i := len(q.frames); i < n; i++ {
+		q.frames = append(q.frames, testFrame(fmt.Sprintf("f%d", i), priorityNormal, ""))
+	}
+}
+
+func TestSendQueuePush(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy BackpressurePolicy
+		queued []outbound
+		// Queued frames beyond queued, all normal priority
+		fill int
+		// Priority of all queued frames instead of normal, if set
+		all  *priority
+		push outbound
+
+		want pushResult
+		// Label of the frame that gives way: a queued one, or "new"
+		dropped string
+		// Label of the queued frame replaced by the new one
+		replaced string
+	}{
+		{
+			name:   "disconnect overflows when full",
+			policy: BackpressureDisconnect,
+			fill:   sendQueueSize,
+			push:   testFrame("new", priorityNormal, ""),
+			want:   pushOverflow,
+		},
+		{
+			name:   "disconnect overflows even for low priority",
+			policy: BackpressureDisconnect,
+			queued: []outbound{testFrame("a", priorityLow, "")},
+			fill:   sendQueueSize,
+			push:   testFrame("new", priorityLow, ""),
+			want:   pushOverflow,
+		},
+		{
+			name:   "queued while room is left",
+			policy: BackpressureDisconnect,
+			fill:   sendQueueSize - 1,
+			push:   testFrame("new", priorityNormal, ""),
+			want:   pushQueued,
+		},
+		{
+			name:    "drop-oldest drops the oldest frame of equal priority",
+			policy:  BackpressureDropOldest,
+			fill:    sendQueueSize,
+			push:    testFrame("new", priorityNormal, ""),
+			want:    pushDroppedQueued,
+			dropped: "f0",
+		},
+		{
+			name:    "drop-oldest drops the oldest frame of the lowest priority",
+			policy:  BackpressureDropOldest,
+			queued:  []outbound{testFrame("a", priorityNormal, ""), testFrame("b", priorityLow, ""), testFrame("c", priorityLow, "")},
+			fill:    sendQueueSize,
+			push:    testFrame("new", priorityNormal, ""),
+			want:    pushDroppedQueued,
+			dropped: "b",
+		},
+		{
+			name:    "drop-oldest drops the new frame if everything queued matters more",
+			policy:  BackpressureDropOldest,
+			fill:    sendQueueSize,
+			push:    testFrame("new", priorityLow, ""),
+			want:    pushDroppedNew,
+			dropped: "new",
+		},
+		{
+			name:    "high priority makes room among lower priorities",
+			policy:  BackpressureDropOldest,
+			queued:  []outbound{testFrame("a", priorityHigh, ""), testFrame("b", priorityNormal, "")},
+			fill:    sendQueueSize,
+			push:    testFrame("new", priorityHigh, ""),
+			want:    pushDroppedQueued,
+			dropped: "b",
+		},
+		{
+			name:   "high priority overflows a queue of high priority frames",
+			policy: BackpressureDropOldest,
+			all:    ptr(priorityHigh),
+			push:   testFrame("new", priorityHigh, ""),
+			want:   pushOverflow,
+		},
+		{
+			name:    "drop-newest drops the new frame of equal priority",
+			policy:  BackpressureDropNewest,
+			fill:    sendQueueSize,
+			push:    testFrame("new", priorityNormal, ""),
+			want:    pushDroppedNew,
+			dropped: "new",
+		},
+		{
+			name:    "drop-newest still drops a lower priority frame",
+			policy:  BackpressureDropNewest,
+			queued:  []outbound{testFrame("a", priorityNormal, ""), testFrame("b", priorityLow, "")},
+			fill:    sendQueueSize,
+			push:    testFrame("new", priorityNormal, ""),
+			want:    pushDroppedQueued,
+			dropped: "b",
+		},
+		{
+			name:   "drop-newest overflows for high priority",
+			policy: BackpressureDropNewest,
+			all:    ptr(priorityHigh),
+			push:   testFrame("new", priorityHigh, ""),
+			want:   pushOverflow,
+		},
+		{
+			name:     "coalesce replaces a frame with the same key before the queue is full",
+			policy:   BackpressureCoalesce,
+			queued:   []outbound{testFrame("a", priorityLow, "typing:u1"), testFrame("b", priorityLow, "typing:u2")},
+			fill:     10,
+			push:     testFrame("new", priorityLow, "typing:u1"),
+			want:     pushCoalesced,
+			replaced: "a",
+		},
+		{
+			name:    "coalesce drops the oldest frame when no key matches",
+			policy:  BackpressureCoalesce,
+			queued:  []outbound{testFrame("a", priorityLow, "typing:u1")},
+			fill:    sendQueueSize,
+			push:    testFrame("new", priorityLow, "typing:u2"),
+			want:    pushDroppedQueued,
+			dropped: "a",
+		},
+		{
+			name:   "other policies don't coalesce",
+			policy: BackpressureDropOldest,
+			queued: []outbound{testFrame("a", priorityLow, "typing:u1")},
+			fill:   10,
+			push:   testFrame("new", priorityLow, "typing:u1"),
+			want:   pushQueued,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newSendQueue(nil)
+			fillSendQueue(q, tt.queued, tt.fill)
+			if tt.all != nil {
+				for i := 0; i < sendQueueSize; i++ {
+					q.frames = append(q.frames, testFrame(fmt.Sprintf("f%d", i), *tt.all, ""))
+				}
+			}
+
+			before := labels(q.frames)
+			var want []string
+			switch {
+			case tt.want == pushOverflow:
+				want = before
+			case tt.replaced != "":
+				want = slices.Clone(before)
+				want[slices.Index(want, tt.replaced)] = "new"
+			default:
+				for _, label := range append(before, "new") {
+					if label != tt.dropped {
+						want = append(want, label)
+					}
+				}
+			}
+
+			if got := q.push(tt.push, tt.policy); got != tt.want {
+				t.Fatalf("push() = %d, want %d", got, tt.want)
+			}
+			if got := labels(q.frames); !slices.Equal(got, want) {
+				t.Errorf("queue = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSendQueuePop(t *testing.T) {
+	q := newSendQueue(nil)
+	for i := 0; i < 10; i++ {
+		q.push(testFrame(fmt.Sprint(i), priorityNormal, ""), BackpressureDisconnect)
+	}
+
+	buf := q.pop(nil, 3)
+	if got, want := labels(buf), []string{"0", "1", "2"}; !slices.Equal(got, want) {
+		t.Errorf("pop(3) = %v, want %v", got, want)
+	}
+
+	q.push(testFrame("10", priorityNormal, ""), BackpressureDisconnect)
+	buf = q.pop(buf, 100)
+	if got, want := labels(buf), []string{"3", "4", "5", "6", "7", "8", "9", "10"}; !slices.Equal(got, want) {
+		t.Errorf("pop(100) = %v, want %v", got, want)
+	}
+
+	if buf = q.pop(buf, 100); len(buf) != 0 || q.len() != 0 {
+		t.Errorf("pop() of an empty queue = %v, %d left", labels(buf), q.len())
+	}
+}
+
+func TestSendQueuePopAfterDrop(t *testing.T) {
+	q := newSendQueue(nil)
+	fillSendQueue(q, []outbound{testFrame("a", priorityNormal, ""), testFrame("b", priorityLow, "")}, sendQueueSize)
+	q.push(testFrame("new", priorityNormal, ""), BackpressureDropOldest)
+
+	buf := q.pop(nil, 3)
+	if got, want := labels(buf), []string{"a", "f2", "f3"}; !slices.Equal(got, want) {
+		t.Errorf("pop(3) = %v, want %v", got, want)
+	}
+
+	buf = q.pop(buf, sendQueueSize)
+	if got := labels(buf); got[len(got)-1] != "new" || len(got) != sendQueueSize-3 {
+		t.Errorf("pop() = %d frames ending with %q, want %d ending with \"new\"", len(got), got[len(got)-1], sendQueueSize-3)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
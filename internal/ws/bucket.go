@@ -0,0 +1,145 @@
+package ws
+
+import (
+	"go-websocket/internal/metrics"
+	"go-websocket/internal/models"
+	"log/slog"
+	"sync"
+)
+
+const (
+	defaultBuckets         = 32
+	defaultBucketQueueSize = 1024
+)
+
+type BucketOptions struct {
+	// Channels are spread over this many buckets, each with its own lock and
+	// broadcast worker; 32 if 0
+	Count int
+
+	// Broadcasts waiting for a bucket worker before some are dropped; 1024 if 0
+	QueueSize int
+}
+
+var (
+	queuedBroadcasts = metrics.NewGauge(
+		"ws_hub_queued_broadcasts",
+		"Broadcasts waiting for a bucket worker",
+	)
+	droppedBroadcasts = metrics.NewCounter(
+		"ws_hub_dropped_broadcasts_total",
+		"Broadcasts dropped because their bucket queue was full",
+	)
+)
+
+type bucket struct {
+	sync.RWMutex
+	channels map[string]map[*Client]bool
+	queue    *broadcastQueue
+}
+
+// broadcastQueue holds the broadcasts waiting for a bucket worker. Pushing
+// never blocks, so a busy bucket can't hold up the Redis subscriber.
+type broadcastQueue struct {
+	mu   sync.Mutex
+	size int
+
+	// Queued messages by priority, each oldest first, so the message to drop
+	// is always at the head of one of them; seq restores the order of arrival
+	queues [priorityHigh + 1][]queuedBroadcast
+	len    int
+	seq    uint64
+
+	// Signaled when messages are queued; the bucket worker is the only receiver
+	ready chan struct{}
+}
+
+type queuedBroadcast struct {
+	seq     uint64
+	message *models.BroadcastMessage
+}
+
+func newBroadcastQueue(size int) *broadcastQueue {
+	return &broadcastQueue{size: size, ready: make(chan struct{}, 1)}
+}
+
+// push queues a message. When the queue is full, the oldest message of the
+// lowest priority is dropped to make room if that is below the new one's, or
+// else the new one.
+func (q *broadcastQueue) push(message *models.BroadcastMessage) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	p := eventPriority(message.Type)
+	if q.len >= q.size {
+		victim := priorityLow
+		for len(q.queues[victim]) == 0 {
+			victim++
+		}
+		if victim >= p {
+			return false
+		}
+
+		dropped := q.queues[victim][0].message
+		q.queues[victim][0] = queuedBroadcast{}
+		q.queues[victim] = q.queues[victim][1:]
+		q.len--
+
+		slog.Warn("[HUB] Broadcast queue full, dropping message", "type", dropped.Type, "channel", dropped.ChannelId)
+		queuedBroadcasts.Dec()
+		droppedBroadcasts.Inc()
+	}
+
+	q.seq++
+	q.queues[p] = append(q.queues[p], queuedBroadcast{seq: q.seq, message: message})
+	q.len++
+	queuedBroadcasts.Inc()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pop moves every queued message into buf, oldest first
+func (q *broadcastQueue) pop(buf []*models.BroadcastMessage) []*models.BroadcastMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	buf = buf[:0]
+	var heads [priorityHigh + 1]int
+	for len(buf) < q.len {
+		next := -1
+		for p := range q.queues {
+			if heads[p] < len(q.queues[p]) && (next < 0 || q.queues[p][heads[p]].seq < q.queues[next][heads[next]].seq) {
+				next = p
+			}
+		}
+		buf = append(buf, q.queues[next][heads[next]].message)
+		heads[next]++
+	}
+
+	for p := range q.queues {
+		clear(q.queues[p])
+		q.queues[p] = q.queues[p][:0]
+	}
+	q.len = 0
+	queuedBroadcasts.Add(-int64(len(buf)))
+	return buf
+}
+
+func (h *Hub) runBucketWorker(bucketIndex int) {
+	slog.Info("[HUB] Starting bucket worker", "bucket", bucketIndex)
+	b := h.buckets[bucketIndex]
+
+	var messages []*models.BroadcastMessage
+	for range b.queue.ready {
+		messages = b.queue.pop(messages)
+		for _, message := range messages {
+			h.broadcastToChannel(message)
+		}
+		clear(messages)
+	}
+
+	slog.Info("[HUB] Bucket worker stopped", "bucket", bucketIndex)
+}
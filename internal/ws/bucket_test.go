@@ -0,0 +1,126 @@
+package ws
+
+import (
+	"go-websocket/internal/models"
+	"slices"
+	"testing"
+)
+
+func broadcast(id, eventType string) *models.BroadcastMessage {
+	return &models.BroadcastMessage{ChannelId: id, Type: eventType}
+}
+
+func broadcastIds(messages []*models.BroadcastMessage) []string {
+	ids := make([]string, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ChannelId
+	}
+	return ids
+}
+
+func TestBroadcastQueuePush(t *testing.T) {
+	const (
+		low    = models.EventTypingStart
+		normal = models.EventReadUpdated
+		high   = models.EventMessageCreated
+	)
+
+	tests := []struct {
+		name   string
+		queued []*models.BroadcastMessage
+		push   *models.BroadcastMessage
+
+		want bool
+		// Messages popped afterwards, oldest first
+		popped []string
+	}{
+		{
+			name:   "queued while room is left",
+			queued: []*models.BroadcastMessage{broadcast("a", normal), broadcast("b", normal)},
+			push:   broadcast("new", normal),
+			want:   true,
+			popped: []string{"a", "b", "new"},
+		},
+		{
+			name:   "drops the oldest message of the lowest priority",
+			queued: []*models.BroadcastMessage{broadcast("a", normal), broadcast("b", low), broadcast("c", normal), broadcast("d", low)},
+			push:   broadcast("new", high),
+			want:   true,
+			popped: []string{"a", "c", "d", "new"},
+		},
+		{
+			name:   "drops the lowest priority, not the first lower one",
+			queued: []*models.BroadcastMessage{broadcast("a", normal), broadcast("b", high), broadcast("c", low), broadcast("d", high)},
+			push:   broadcast("new", high),
+			want:   true,
+			popped: []string{"a", "b", "d", "new"},
+		},
+		{
+			name:   "drops a lower priority for a normal message",
+			queued: []*models.BroadcastMessage{broadcast("a", high), broadcast("b", normal), broadcast("c", low), broadcast("d", high)},
+			push:   broadcast("new", normal),
+			want:   true,
+			popped: []string{"a", "b", "d", "new"},
+		},
+		{
+			name:   "drops the new message if nothing queued is lower",
+			queued: []*models.BroadcastMessage{broadcast("a", normal), broadcast("b", high), broadcast("c", normal), broadcast("d", high)},
+			push:   broadcast("new", normal),
+			want:   false,
+			popped: []string{"a", "b", "c", "d"},
+		},
+		{
+			name:   "drops a high priority message if the queue is all high",
+			queued: []*models.BroadcastMessage{broadcast("a", high), broadcast("b", high), broadcast("c", high), broadcast("d", high)},
+			push:   broadcast("new", high),
+			want:   false,
+			popped: []string{"a", "b", "c", "d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newBroadcastQueue(4)
+			for _, m := range tt.queued {
+				if !q.push(m) {
+					t.Fatalf("push(%s) failed before the queue was full", m.ChannelId)
+				}
+			}
+
+			if got := q.push(tt.push); got != tt.want {
+				t.Errorf("push() = %v, want %v", got, tt.want)
+			}
+			if got := broadcastIds(q.pop(nil)); !slices.Equal(got, tt.popped) {
+				t.Errorf("pop() = %v, want %v", got, tt.popped)
+			}
+		})
+	}
+}
+
+func TestBroadcastQueuePop(t *testing.T) {
+	q := newBroadcastQueue(4)
+	q.push(broadcast("a", models.EventMessageCreated))
+	q.push(broadcast("b", models.EventTypingStart))
+	q.push(broadcast("c", models.EventReadUpdated))
+
+	buf := q.pop(nil)
+	if got, want := broadcastIds(buf), []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("pop() = %v, want %v", got, want)
+	}
+
+	// Interleaved priorities keep their order of arrival after a drop too
+	q.push(broadcast("d", models.EventTypingStart))
+	q.push(broadcast("e", models.EventMessageCreated))
+	q.push(broadcast("f", models.EventTypingStop))
+	q.push(broadcast("g", models.EventReadUpdated))
+	q.push(broadcast("h", models.EventMessageDeleted))
+
+	buf = q.pop(buf)
+	if got, want := broadcastIds(buf), []string{"e", "f", "g", "h"}; !slices.Equal(got, want) {
+		t.Errorf("pop() = %v, want %v", got, want)
+	}
+
+	if buf = q.pop(buf); len(buf) != 0 {
+		t.Errorf("pop() of an empty queue = %v", broadcastIds(buf))
+	}
+}
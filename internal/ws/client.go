@@ -1,8 +1,12 @@
 package ws
 
 import (
+	"errors"
+	"go-websocket/internal/models"
 	"log/slog"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/goccy/go-json"
@@ -26,79 +30,160 @@ const (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	// Idle connections hold no write buffer; one is taken for each write
+	WriteBufferPool: &sync.Pool{},
+	Subprotocols:    protocolNames(),
 	CheckOrigin: func(r *http.Request) bool {
 		// TODO: Validate origin in production
 		return true
 	},
 }
 
+// outbound is a frame queued for a client. Broadcasts carry a prepared message
+// shared with the other recipients; data is always the encoded payload.
+type outbound struct {
+	data     []byte
+	prepared *websocket.PreparedMessage
+
+	// Which frames give way when the queue is full, see sendQueue
+	priority priority
+	key      string
+}
+
 type Client struct {
-	hub       *Hub
-	conn      *websocket.Conn
-	send      chan []byte
-	channelId string
-	userId    string
-	userName  string
+	id         string
+	hub        *Hub
+	conn       *websocket.Conn
+	netConn    *netConn
+	send       *sendQueue
+	policy     BackpressurePolicy
+	channelId  string
+	userId     string
+	userName   string
+	userEmail  string
+	userAvatar string
+	limiter    *clientLimiter
+	release    func()
+	heartbeat  heartbeat
+	connected  time.Time
+	protocol   *Protocol
+	compress   bool
+
+	// Closed exactly once to stop WritePump, see close
+	done         chan struct{}
+	closeOnce    sync.Once
+	closeMessage []byte
+
+	// Set when the hub disconnects the client for not keeping up
+	evicted atomic.Bool
+
+	// Set if the connection is served by the event loop, see useEventLoop
+	loop *eventLoopState
+
+	// Threads the client is viewing, read by the bucket workers
+	threadsMu sync.RWMutex
+	threads   map[string]bool
+
+	// message:send requests waiting for the store, see handleMessageSend
+	saves messageSaves
+}
+
+// UserId returns the authenticated user of the connection
+func (c *Client) UserId() string { return c.userId }
+
+// UserName returns the display name of the authenticated user
+func (c *Client) UserName() string { return c.userName }
+
+// ChannelId returns the channel the connection joined
+func (c *Client) ChannelId() string { return c.channelId }
+
+// Send queues an event for this connection only
+func (c *Client) Send(eventType string, data interface{}) {
+	c.sendEvent(eventType, data)
 }
 
 // ReadPump pumps messages from WebSocket to hub
 func (c *Client) ReadPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.unregisterClient(c)
 		c.conn.Close()
+		c.release()
 	}()
 
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
-		return nil
-	})
+	c.conn.SetReadDeadline(time.Now().Add(c.readTimeout()))
+	c.conn.SetPongHandler(c.handleControlPong)
 
 	for {
-		_, message, err := c.conn.ReadMessage()
+		_, frame, err := c.conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				slog.Warn("[CLIENT] Unexpected close", "user", c.userId, "channel", c.channelId, "error", err)
-			}
+			c.logReadError(err)
 			break
 		}
 
-		c.handleClientMessage(message)
+		// Any message proves the client is alive, even if pongs are stripped
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout()))
+
+		if !c.handleFrame(frame) {
+			break
+		}
+	}
+}
+
+func (c *Client) logReadError(err error) {
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+		slog.Warn("[CLIENT] Unexpected close", "user", c.userId, "channel", c.channelId, "error", err)
+	}
+}
+
+// handleFrame decodes and handles one inbound frame and reports whether the
+// connection should stay open
+func (c *Client) handleFrame(frame []byte) bool {
+	message, err := c.protocol.Codec.Decode(frame)
+	if err != nil {
+		slog.Warn("[CLIENT] Failed to decode frame", "protocol", c.protocol.Name, "user", c.userId, "channel", c.channelId, "error", err)
+		c.sendError(ErrCodeInvalidJSON, "Message could not be decoded", "")
+		return true
 	}
+	return c.handleClientMessage(message)
 }
 
 // WritePump pumps messages from hub to WebSocket
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.pingInterval())
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
 	}()
 
+	var frames []outbound
 	for {
 		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+		case <-c.send.ready:
+			// Frames still queued when the client is closed are dropped
+			if c.closed() {
+				c.writeClose()
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				slog.Error("[CLIENT] Failed to get writer", "user", c.userId, "channel", c.channelId, "error", err)
-				return
+			frames = c.send.pop(frames, max(c.hub.opts.Coalesce.MaxFrames, 1))
+			if len(frames) == 0 {
+				continue
 			}
-			w.Write(message)
 
-			if err := w.Close(); err != nil {
-				slog.Error("[CLIENT] Failed to close writer", "user", c.userId, "channel", c.channelId, "error", err)
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			err := c.writeFrames(frames)
+			clear(frames)
+			if err != nil {
+				slog.Error("[CLIENT] Failed to write message", "user", c.userId, "channel", c.channelId, "error", err)
 				return
 			}
 
+		case <-c.done:
+			c.writeClose()
+			return
+
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := c.writePing(); err != nil {
 				slog.Error("[CLIENT] Failed to send ping", "user", c.userId, "channel", c.channelId, "error", err)
 				return
 			}
@@ -106,45 +191,137 @@ func (c *Client) WritePump() {
 	}
 }
 
-func (c *Client) handleClientMessage(message []byte) {
-	var msg map[string]interface{}
-	if err := json.Unmarshal(message, &msg); err != nil {
+// close makes WritePump send a close frame and stop, dropping queued frames.
+// Only the first call has an effect. The send channel itself is never closed,
+// so goroutines queueing frames can't race with it.
+func (c *Client) close(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeMessage = websocket.FormatCloseMessage(code, text)
+		close(c.done)
+		// Event loop connections only start writing when signaled
+		c.send.signal()
+	})
+}
+
+func (c *Client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) writeClose() {
+	c.conn.WriteControl(websocket.CloseMessage, c.closeMessage, time.Now().Add(writeWait))
+}
+
+func (c *Client) write(message outbound) error {
+	c.setWriteCompression(len(message.data))
+	if message.prepared != nil {
+		return c.conn.WritePreparedMessage(message.prepared)
+	}
+
+	w, err := c.conn.NextWriter(c.protocol.Codec.MessageType())
+	if err != nil {
+		return err
+	}
+	w.Write(message.data)
+	return w.Close()
+}
+
+// handleClientMessage processes one inbound message and reports whether the
+// connection should stay open. Requests with an id are answered with an ack
+// frame once processed; every rejected message is answered with an error frame.
+func (c *Client) handleClientMessage(message []byte) bool {
+	if !json.Valid(message) {
+		slog.Error("[CLIENT] Received invalid JSON", "user", c.userId, "channel", c.channelId)
+		c.sendError(ErrCodeInvalidJSON, "Message is not valid JSON", "")
+		return true
+	}
+
+	var req Request
+	if err := json.Unmarshal(message, &req); err != nil {
 		slog.Error("[CLIENT] Error unmarshaling message", "user", c.userId, "channel", c.channelId, "error", err)
-		return
+		c.sendError(ErrCodeInvalidRequest, "Message is not a valid request", "")
+		return true
 	}
 
-	eventType, ok := msg["type"].(string)
-	if !ok {
+	if req.Type == "" {
 		slog.Warn("[CLIENT] No 'type' field in message", "user", c.userId, "channel", c.channelId)
-		return
+		c.sendError(ErrCodeMissingType, "Message has no 'type' field", req.Id)
+		return true
 	}
 
-	switch eventType {
-	case "typing:start":
-		var threadId *string
-		if data, ok := msg["data"].(map[string]interface{}); ok {
-			if tid, ok := data["threadId"].(string); ok && tid != "" {
-				threadId = &tid
-			}
-		}
+	handler, ok := c.hub.handler(req.Type)
+	if !ok {
+		slog.Warn("[CLIENT] Unknown event type", "type", req.Type, "user", c.userId, "channel", c.channelId)
+		c.sendError(ErrCodeUnknownType, "Unknown event type '"+req.Type+"'", req.Id)
+		return true
+	}
 
-		if err := c.hub.redisClient.PublishTypingStart(c.channelId, c.userId, c.userName, threadId); err != nil {
-			slog.Error("[CLIENT] Failed to publish typing:start", "user", c.userId, "channel", c.channelId, "error", err)
-		}
+	result, err := handler(c, &req)
+	if err != nil {
+		var reqErr *Error
+		var closeErr *CloseError
 
-	case "typing:stop":
-		var threadId *string
-		if data, ok := msg["data"].(map[string]interface{}); ok {
-			if tid, ok := data["threadId"].(string); ok && tid != "" {
-				threadId = &tid
-			}
+		switch {
+		case errors.Is(err, ErrDrop), errors.Is(err, ErrDeferred):
+			// Rejected silently, or answered by the handler later
+		case errors.As(err, &closeErr):
+			c.conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(closeErr.Code, closeErr.Text),
+				time.Now().Add(writeWait),
+			)
+			return false
+		case errors.As(err, &reqErr):
+			c.sendError(reqErr.Code, reqErr.Message, req.Id)
+		default:
+			slog.Error("[CLIENT] Handler failed", "type", req.Type, "user", c.userId, "channel", c.channelId, "error", err)
+			c.sendError(ErrCodeInternal, "Failed to process '"+req.Type+"'", req.Id)
 		}
+		return true
+	}
 
-		if err := c.hub.redisClient.PublishTypingStop(c.channelId, c.userId, threadId); err != nil {
-			slog.Error("[CLIENT] Failed to publish typing:stop", "user", c.userId, "channel", c.channelId, "error", err)
-		}
+	if req.Id != "" {
+		c.sendEvent("ack", models.AckData{Id: req.Id, Result: result})
+	}
 
-	default:
-		slog.Warn("[CLIENT] Unknown event type", "type", eventType, "user", c.userId, "channel", c.channelId)
+	return true
+}
+
+// sendError queues an error frame for this client
+func (c *Client) sendError(code, message, requestId string) {
+	c.sendEvent("error", models.ErrorData{
+		Code:    code,
+		Message: message,
+		Id:      requestId,
+	})
+}
+
+// sendEvent queues an event for this client only, dropping it if the send
+// buffer is full and holds nothing of lower priority
+func (c *Client) sendEvent(eventType string, data interface{}) {
+	payload, err := json.Marshal(models.Event{
+		Type:      eventType,
+		ChannelId: c.channelId,
+		Timestamp: time.Now().Unix(),
+		Data:      data,
+	})
+	if err != nil {
+		slog.Error("[CLIENT] Failed to marshal event", "type", eventType, "user", c.userId, "channel", c.channelId, "error", err)
+		return
+	}
+
+	payload, err = c.protocol.Codec.Encode(payload)
+	if err != nil {
+		slog.Error("[CLIENT] Failed to encode event", "type", eventType, "protocol", c.protocol.Name, "user", c.userId, "channel", c.channelId, "error", err)
+		return
+	}
+
+	frame := outbound{data: payload, priority: eventPriority(eventType)}
+	if result := c.send.push(frame, BackpressureDropNewest); result == pushDroppedNew || result == pushOverflow {
+		slog.Warn("[CLIENT] Send buffer full, dropping event", "type", eventType, "user", c.userId, "channel", c.channelId)
 	}
 }
@@ -0,0 +1,35 @@
+package ws
+
+import "go-websocket/internal/metrics"
+
+type CoalesceOptions struct {
+	// Frames already queued when WritePump wakes up are sent with a single
+	// network write, up to this many; 1 or less disables coalescing
+	MaxFrames int
+}
+
+var coalescedFrames = metrics.NewHistogram(
+	"ws_write_coalesced_frames",
+	"Frames sent per network write when WritePump found frames queued",
+	[]float64{2, 4, 8, 16, 32, 64, 128},
+)
+
+// writeFrames writes the frames WritePump took from the queue with one network
+// write
+func (c *Client) writeFrames(frames []outbound) error {
+	if len(frames) == 1 {
+		return c.write(frames[0])
+	}
+
+	c.netConn.cork()
+	var err error
+	for i := 0; i < len(frames) && err == nil; i++ {
+		err = c.write(frames[i])
+	}
+
+	if uncorkErr := c.netConn.uncork(); err == nil {
+		err = uncorkErr
+	}
+	coalescedFrames.Observe(float64(len(frames)))
+	return err
+}
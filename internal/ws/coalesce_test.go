@@ -0,0 +1,40 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/internal/ws/wstest"
+	"testing"
+)
+
+// BenchmarkWriteCoalesced writes a burst of queued frames the way WritePump
+// does, one network write per frame and with up to 64 frames per write
+func BenchmarkWriteCoalesced(b *testing.B) {
+	const burst = 64
+
+	hub := NewHub(wstest.NopPublisher{}, Options{})
+	client, conn := newDiscardClient(b, hub, "channel_bench", false)
+
+	frames := make([]outbound, burst)
+	for i := range frames {
+		var err error
+		if frames[i], err = (frameCache{}).prepare(client.protocol, messageCreated(i, 256)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, maxFrames := range []int{1, burst} {
+		b.Run(fmt.Sprintf("max-frames=%d", maxFrames), func(b *testing.B) {
+			conn.writes.Store(0)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < burst; j += maxFrames {
+					if err := client.writeFrames(frames[j : j+maxFrames]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*burst), "ns/frame")
+			b.ReportMetric(float64(conn.writes.Load())/float64(b.N*burst), "writes/frame")
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package ws
+
+import (
+	"go-websocket/internal/pb"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Binary encodings of the v2 envelope, for clients on constrained networks
+
+var (
+	protocolV2Proto   = &Protocol{Name: "gows.v2.proto", Version: 2, Codec: protobufCodec{}}
+	protocolV2MsgPack = &Protocol{Name: "gows.v2.msgpack", Version: 2, Codec: msgpackCodec{}}
+	protocolV2CBOR    = &Protocol{Name: "gows.v2.cbor", Version: 2, Codec: cborCodec{}}
+)
+
+// protobuf: the messages of proto/events.proto
+type protobufCodec struct{}
+
+func (protobufCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (protobufCodec) Encode(event []byte) ([]byte, error) {
+	e, err := pb.EventFromJSON(event)
+	if err != nil {
+		return nil, err
+	}
+	e.Timestamp = toMillis(e.Timestamp)
+	e.ExcludeConnectionId = ""
+	e.ExcludeUserId = ""
+	return e.Marshal(), nil
+}
+
+func (protobufCodec) Decode(frame []byte) ([]byte, error) {
+	var request pb.Request
+	if err := request.Unmarshal(frame); err != nil {
+		return nil, err
+	}
+	return request.JSON()
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Encode(event []byte) ([]byte, error) {
+	envelope, err := decodeEnvelope(event)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(normalizeNumbers(envelope))
+}
+
+func (msgpackCodec) Decode(frame []byte) ([]byte, error) {
+	var request interface{}
+	if err := msgpack.Unmarshal(frame, &request); err != nil {
+		return nil, err
+	}
+	return json.Marshal(request)
+}
+
+// Decode CBOR maps with string keys so requests convert back to JSON
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+}.DecMode()
+
+type cborCodec struct{}
+
+func (cborCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (cborCodec) Encode(event []byte) ([]byte, error) {
+	envelope, err := decodeEnvelope(event)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(normalizeNumbers(envelope))
+}
+
+func (cborCodec) Decode(frame []byte) ([]byte, error) {
+	var request interface{}
+	if err := cborDecMode.Unmarshal(frame, &request); err != nil {
+		return nil, err
+	}
+	return json.Marshal(request)
+}
+
+// normalizeNumbers replaces json.Number values with int64 or float64 so
+// binary encoders emit them as numbers rather than strings
+func normalizeNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = normalizeNumbers(item)
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeNumbers(item)
+		}
+		return value
+	default:
+		return v
+	}
+}
@@ -0,0 +1,66 @@
+package ws
+
+import (
+	"go-websocket/internal/metrics"
+	"net/http"
+	"strings"
+)
+
+type CompressionOptions struct {
+	// Negotiate permessage-deflate with clients that offer it
+	Enabled bool
+
+	// Deflate level, from -2 (Huffman only) to 9 (best compression)
+	Level int
+
+	// Frames smaller than this many bytes are sent uncompressed
+	MinSize int
+}
+
+var (
+	compressionPayloadBytes = metrics.NewCounter(
+		"ws_compression_payload_bytes_total",
+		"Payload bytes of frames sent on connections with compression negotiated",
+	)
+	compressionWireBytes = metrics.NewCounter(
+		"ws_compression_wire_bytes_total",
+		"Bytes written to the network by connections with compression negotiated",
+	)
+	compressionFrames = metrics.NewCounterVec(
+		"ws_compression_frames_total",
+		"Frames sent on connections with compression negotiated, by whether they were compressed",
+		"result",
+	)
+)
+
+// offersDeflate reports whether the client offered permessage-deflate, in
+// which case the upgrader accepts it
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-Websocket-Extensions") {
+		for _, extension := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setWriteCompression decides whether the next frame of the given size is
+// compressed
+func (c *Client) setWriteCompression(size int) {
+	if !c.compress {
+		return
+	}
+
+	compressed := size >= c.hub.opts.Compression.MinSize
+	c.conn.EnableWriteCompression(compressed)
+
+	compressionPayloadBytes.Add(int64(size))
+	if compressed {
+		compressionFrames.Inc("compressed")
+	} else {
+		compressionFrames.Inc("uncompressed")
+	}
+}
@@ -0,0 +1,41 @@
+package ws
+
+import "time"
+
+// ConnectionInfo describes an open connection for the admin API
+type ConnectionInfo struct {
+	ConnectionId  string    `json:"connectionId"`
+	UserId        string    `json:"userId"`
+	ChannelId     string    `json:"channelId"`
+	ConnectedAt   time.Time `json:"connectedAt"`
+	AppHeartbeat  bool      `json:"appHeartbeat"`
+	Compression   bool      `json:"compression"`
+	LatencyMs     float64   `json:"latencyMs"`
+	PendingFrames int       `json:"pendingFrames"`
+}
+
+// Connections lists the connections registered on this node
+func (h *Hub) Connections() []ConnectionInfo {
+	connections := []ConnectionInfo{}
+
+	for _, b := range h.buckets {
+		b.RLock()
+		for _, clients := range b.channels {
+			for client := range clients {
+				connections = append(connections, ConnectionInfo{
+					ConnectionId:  client.id,
+					UserId:        client.userId,
+					ChannelId:     client.channelId,
+					ConnectedAt:   client.connected,
+					AppHeartbeat:  client.heartbeat.app,
+					Compression:   client.compress,
+					LatencyMs:     float64(client.Latency()) / float64(time.Millisecond),
+					PendingFrames: client.send.len(),
+				})
+			}
+		}
+		b.RUnlock()
+	}
+
+	return connections
+}
@@ -0,0 +1,31 @@
+package ws
+
+// Error codes sent to clients in the data.code field of an "error" frame
+const (
+	// The message is not valid JSON
+	ErrCodeInvalidJSON = "invalid_json"
+
+	// The message is JSON but not a request object
+	ErrCodeInvalidRequest = "invalid_request"
+
+	// The message has no "type" field
+	ErrCodeMissingType = "missing_type"
+
+	// The server has no handler for the message type
+	ErrCodeUnknownType = "unknown_type"
+
+	// The "data" field doesn't match what the message type expects
+	ErrCodeInvalidPayload = "invalid_payload"
+
+	// The event was accepted but could not be published to Redis
+	ErrCodePublishFailed = "publish_failed"
+
+	// The message could not be persisted
+	ErrCodePersistFailed = "persist_failed"
+
+	// The client exceeded a rate limit for the message type
+	ErrCodeRateLimited = "rate_limited"
+
+	// The server failed to process the message
+	ErrCodeInternal = "internal_error"
+)
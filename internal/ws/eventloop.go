@@ -0,0 +1,355 @@
+package ws
+
+import (
+	"encoding/binary"
+	"go-websocket/internal/metrics"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Time allowed to receive the rest of a frame once it started arriving, on
+// event loop connections
+const frameWait = 10 * time.Second
+
+// TransportMode decides what serves a connection while it is idle
+type TransportMode string
+
+const (
+	// Each connection owns a ReadPump and a WritePump goroutine
+	TransportGoroutines TransportMode = "goroutines"
+
+	// Connections are watched with epoll and own no goroutine while idle.
+	// Linux only; elsewhere the hub falls back to goroutines.
+	TransportEpoll TransportMode = "epoll"
+)
+
+type TransportOptions struct {
+	// TransportGoroutines if empty
+	Mode TransportMode
+
+	// Give each connection its own write buffer instead of taking one from a
+	// shared pool for each write; only there to measure what the pool saves
+	DedicatedWriteBuffers bool
+}
+
+// ValidTransportMode reports whether m is one of the modes above
+func ValidTransportMode(m TransportMode) bool {
+	switch m {
+	case TransportGoroutines, TransportEpoll:
+		return true
+	}
+	return false
+}
+
+var eventLoopConnections = metrics.NewGauge(
+	"ws_eventloop_connections",
+	"Connections watched by the event loop instead of owning goroutines",
+)
+
+// poller tells the hub when event loop connections have something to read.
+// A connection is reported once, then not again until rearmed.
+type poller interface {
+	add(c *Client) error
+	rearm(c *Client) error
+	// remove reports whether the connection was watched
+	remove(c *Client) bool
+}
+
+var eventLoopTags atomic.Uint32
+
+// eventLoopState is the state of a connection served by the event loop
+type eventLoopState struct {
+	// Descriptor and tag of the connection in the poller, which sets fd to
+	// -1 once removed; the tag tells events of a reused descriptor apart
+	fd  int
+	tag uint32
+
+	// Held while a goroutine reads the connection
+	readMu sync.Mutex
+
+	// Set while a flush goroutine runs
+	writing atomic.Bool
+	pingDue atomic.Bool
+
+	// Unix nanoseconds of the last frame received
+	lastRead atomic.Int64
+
+	teardownOnce sync.Once
+	// Set once torn down, for the heartbeat wheel to let go of the connection
+	stopped atomic.Bool
+}
+
+// useEventLoop prepares a client to be served by the event loop, if its
+// connection has a descriptor to watch. Connections without one, e.g. behind
+// TLS, keep their goroutines.
+func (c *Client) useEventLoop() bool {
+	fd, ok := connFd(c.netConn.Conn)
+	if !ok || c.netConn.reader == nil {
+		return false
+	}
+
+	c.loop = &eventLoopState{fd: fd, tag: eventLoopTags.Add(1)}
+	c.loop.lastRead.Store(time.Now().UnixNano())
+	c.heartbeat.sentAt.Store(time.Now().UnixNano())
+	c.send = newSendQueue(c.wake)
+	c.conn.SetPongHandler(c.handleControlPong)
+	return true
+}
+
+func connFd(conn net.Conn) (int, bool) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	fd := -1
+	raw.Control(func(f uintptr) { fd = int(f) })
+	return fd, fd >= 0
+}
+
+// watch hands a registered client to the poller
+func (h *Hub) watch(c *Client) {
+	if err := h.poller.add(c); err != nil {
+		slog.Error("[HUB] Failed to watch connection", "user", c.userId, "channel", c.channelId, "error", err)
+		c.teardown()
+		return
+	}
+	eventLoopConnections.Inc()
+	h.heartbeats.schedule(c, time.Now().Add(c.pingInterval()))
+}
+
+// teardown is ReadPump's exit for event loop connections. It runs once,
+// whichever of the reader, the writer or the heartbeats finds the connection
+// gone first.
+func (c *Client) teardown() {
+	c.loop.teardownOnce.Do(func() {
+		c.loop.stopped.Store(true)
+		if c.hub.poller.remove(c) {
+			eventLoopConnections.Dec()
+		}
+		c.hub.unregisterClient(c)
+		c.conn.Close()
+		c.release()
+	})
+}
+
+// readEvents handles what a readable connection has sent, on a goroutine
+// that only lives until the read buffer is empty. The buffer comes from a
+// pool, and goes back to it before the connection is rearmed.
+func (c *Client) readEvents() {
+	c.loop.readMu.Lock()
+	defer c.loop.readMu.Unlock()
+
+	c.netConn.takeReader()
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(frameWait))
+
+		handled, err := c.readControl()
+		if err == nil && !handled {
+			var frame []byte
+			if _, frame, err = c.conn.ReadMessage(); err == nil && !c.handleFrame(frame) {
+				c.teardown()
+				return
+			}
+		}
+		if err != nil {
+			c.logReadError(err)
+			c.teardown()
+			return
+		}
+
+		c.loop.lastRead.Store(time.Now().UnixNano())
+		if c.netConn.reader.Buffered() == 0 {
+			break
+		}
+	}
+
+	c.netConn.releaseReader()
+	if err := c.hub.poller.rearm(c); err != nil {
+		slog.Error("[CLIENT] Failed to rearm connection", "user", c.userId, "channel", c.channelId, "error", err)
+		c.teardown()
+	}
+}
+
+// readControl handles a control frame at the head of the read buffer and
+// reports whether there was one. gorilla would handle it too, but then block
+// until a data frame arrives. Anything else, including malformed control
+// frames, is left to gorilla.
+func (c *Client) readControl() (bool, error) {
+	head, err := c.netConn.reader.Peek(2)
+	if err != nil {
+		return false, err
+	}
+
+	// FIN set, no reserved bits, masked, with a payload of up to 125 bytes
+	opcode := int(head[0] & 0x0f)
+	if head[0]&0xf0 != 0x80 || opcode < websocket.CloseMessage || opcode > websocket.PongMessage ||
+		head[1]&0x80 == 0 || head[1]&0x7f > 125 {
+		return false, nil
+	}
+
+	n := 6 + int(head[1]&0x7f)
+	frame, err := c.netConn.reader.Peek(n)
+	if err != nil {
+		return false, err
+	}
+	payload := make([]byte, n-6)
+	for i := range payload {
+		payload[i] = frame[6+i] ^ frame[2+i%4]
+	}
+	c.netConn.reader.Discard(n)
+
+	switch opcode {
+	case websocket.PingMessage:
+		c.conn.WriteControl(websocket.PongMessage, payload, time.Now().Add(writeWait))
+	case websocket.PongMessage:
+		c.handleControlPong(string(payload))
+	case websocket.CloseMessage:
+		closeErr := &websocket.CloseError{Code: websocket.CloseNoStatusReceived}
+		if len(payload) >= 2 {
+			closeErr.Code = int(binary.BigEndian.Uint16(payload))
+			closeErr.Text = string(payload[2:])
+		}
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeErr.Code, ""), time.Now().Add(writeWait))
+		return true, closeErr
+	}
+	return true, nil
+}
+
+// wake starts a flush goroutine unless one is running
+func (c *Client) wake() {
+	if c.loop.writing.CompareAndSwap(false, true) {
+		go c.flush()
+	}
+}
+
+// flush is WritePump for event loop connections. It exits once nothing is
+// left to write.
+func (c *Client) flush() {
+	var frames []outbound
+	for {
+		// Frames still queued when the client is closed are dropped
+		if c.closed() {
+			c.writeClose()
+			c.teardown()
+			return
+		}
+
+		if c.loop.pingDue.Swap(false) {
+			if err := c.writePing(); err != nil {
+				slog.Error("[CLIENT] Failed to send ping", "user", c.userId, "channel", c.channelId, "error", err)
+				c.teardown()
+				return
+			}
+		}
+
+		frames = c.send.pop(frames, max(c.hub.opts.Coalesce.MaxFrames, 1))
+		if len(frames) == 0 {
+			// Whatever was queued after the pop found writing still set, so
+			// this goroutine carries on unless another one took over
+			c.loop.writing.Store(false)
+			if !c.writePending() || !c.loop.writing.CompareAndSwap(false, true) {
+				return
+			}
+			continue
+		}
+
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		err := c.writeFrames(frames)
+		clear(frames)
+		if err != nil {
+			slog.Error("[CLIENT] Failed to write message", "user", c.userId, "channel", c.channelId, "error", err)
+			c.teardown()
+			return
+		}
+	}
+}
+
+func (c *Client) writePending() bool {
+	return c.closed() || c.loop.pingDue.Load() || c.send.len() > 0
+}
+
+// Slots of the heartbeat wheel, one per second. Checks due later wait in the
+// last slot and are rescheduled from there.
+const heartbeatSlots = 64
+
+// heartbeatWheel holds each event loop connection in the slot of the second
+// its next ping or read deadline falls in, so that a tick only visits the
+// connections that may be due. Reads don't move connections: a connection
+// found not due yet is put back in a later slot.
+type heartbeatWheel struct {
+	mu    sync.Mutex
+	slots [heartbeatSlots][]*Client
+	pos   int
+}
+
+// schedule checks c again at the tick closest to at, which may come up to a
+// second early; a connection checked early is scheduled again
+func (w *heartbeatWheel) schedule(c *Client, at time.Time) {
+	delay := int((time.Until(at) + time.Second - 1) / time.Second)
+	delay = min(max(delay, 1), heartbeatSlots-1)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	slot := (w.pos + delay) % heartbeatSlots
+	w.slots[slot] = append(w.slots[slot], c)
+}
+
+// advance moves to the next slot and returns its connections. The slot keeps
+// buf in exchange.
+func (w *heartbeatWheel) advance(buf []*Client) []*Client {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pos = (w.pos + 1) % heartbeatSlots
+	due := w.slots[w.pos]
+	w.slots[w.pos] = buf[:0]
+	return due
+}
+
+// runHeartbeats does for event loop connections what the ticker of WritePump
+// and the read deadline of ReadPump do for the others: it pings connections
+// when due and tears down the ones that stayed silent too long
+func (h *Hub) runHeartbeats() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var due []*Client
+	for now := range ticker.C {
+		due = h.heartbeats.advance(due)
+		for _, c := range due {
+			if c.loop.stopped.Load() {
+				continue
+			}
+
+			deadline := time.Unix(0, c.loop.lastRead.Load()).Add(c.readTimeout())
+			if now.After(deadline) {
+				slog.Info("[CLIENT] Closing silent connection", "user", c.userId, "channel", c.channelId)
+				c.teardown()
+				continue
+			}
+
+			ping := time.Unix(0, c.heartbeat.sentAt.Load()).Add(c.pingInterval())
+			if !now.Before(ping) {
+				c.loop.pingDue.Store(true)
+				c.wake()
+				ping = now.Add(c.pingInterval())
+			}
+			if deadline.Before(ping) {
+				ping = deadline
+			}
+			h.heartbeats.schedule(c, ping)
+		}
+		clear(due)
+	}
+}
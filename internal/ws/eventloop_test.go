@@ -0,0 +1,194 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestEventLoopReads sends bursts of control and data frames, some larger than
+// the read buffer, and checks that idle connections hold no read buffer
+func TestEventLoopReads(t *testing.T) {
+	srv := newTestServer(t, Options{Transport: TransportOptions{Mode: TransportEpoll}})
+	if srv.hub.poller == nil {
+		t.Skip("no event loop on this platform")
+	}
+
+	conn, err := srv.dial("user_a", "channel_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Welcome frame
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	client := serverClient(t, srv.hub, "channel_test")
+
+	pongs := make(chan string, 1)
+	conn.SetPongHandler(func(data string) error {
+		pongs <- data
+		return nil
+	})
+
+	for round := 0; round < 3; round++ {
+		waitReleased(t, client)
+
+		conn.WriteControl(websocket.PingMessage, []byte("hello"), time.Now().Add(time.Second))
+		padding := strings.Repeat("x", 2*upgrader.ReadBufferSize)
+		for i := 0; i < 5; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"req","type":"ping","data":{"padding":"`+padding+`"}}`))
+		}
+
+		for acks := 0; acks < 5; {
+			_, frame, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(frame), `"ack"`) {
+				acks++
+			}
+		}
+		select {
+		case data := <-pongs:
+			if data != "hello" {
+				t.Errorf("pong carried %q", data)
+			}
+		default:
+			t.Error("no pong")
+		}
+	}
+	waitReleased(t, client)
+
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	if closeErr, ok := err.(*websocket.CloseError); !ok || closeErr.Code != websocket.CloseNormalClosure {
+		t.Errorf("closed with %v", err)
+	}
+	if remaining := srv.waitConnections(0, 2*time.Second); remaining > 0 {
+		t.Errorf("%d connections still registered", remaining)
+	}
+}
+
+// TestEventLoopTLSFallback checks that TLS connections, which have no file
+// descriptor to watch, are served by ReadPump with a usable read buffer
+func TestEventLoopTLSFallback(t *testing.T) {
+	srv := newTestServer(t, Options{Transport: TransportOptions{Mode: TransportEpoll}})
+	if srv.hub.poller == nil {
+		t.Skip("no event loop on this platform")
+	}
+	tlsServer := httptest.NewTLSServer(srv.http.Config.Handler)
+	defer tlsServer.Close()
+
+	dialer := websocket.Dialer{TLSClientConfig: tlsServer.Client().Transport.(*http.Transport).TLSClientConfig}
+	url := "wss" + strings.TrimPrefix(tlsServer.URL, "https") + "/ws?channelId=channel_test&token=" + srv.token("user_a")
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Welcome frame
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if client := serverClient(t, srv.hub, "channel_test"); client.loop != nil {
+		t.Error("TLS connection watched by the poller")
+	}
+
+	padding := strings.Repeat("x", 2*upgrader.ReadBufferSize)
+	for i := 0; i < 5; i++ {
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"req","type":"ping","data":{"padding":"`+padding+`"}}`))
+	}
+	for acks := 0; acks < 5; {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(frame), `"ack"`) {
+			acks++
+		}
+	}
+}
+
+// serverClient returns the only client of a channel
+func serverClient(t *testing.T, hub *Hub, channelId string) *Client {
+	b := hub.getBucket(channelId)
+	b.RLock()
+	defer b.RUnlock()
+
+	for client := range b.channels[channelId] {
+		return client
+	}
+	t.Fatal("client not registered")
+	return nil
+}
+
+// waitReleased waits for the client's read buffer to go back to the pool
+func waitReleased(t *testing.T, c *Client) {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.loop.readMu.Lock()
+		released := c.netConn.pooled == nil
+		c.loop.readMu.Unlock()
+
+		if released {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("read buffer still held")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestEventLoopHeartbeat checks that silent connections are pinged, then torn
+// down once their read timeout passes
+func TestEventLoopHeartbeat(t *testing.T) {
+	srv := newTestServer(t, Options{
+		Transport: TransportOptions{Mode: TransportEpoll},
+		Heartbeat: HeartbeatOptions{AppInterval: time.Second},
+	})
+	if srv.hub.poller == nil {
+		t.Skip("no event loop on this platform")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(srv.url("user_a", "channel_test")+"&heartbeat=app", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Never answered, so the connection is closed after two intervals
+	start := time.Now()
+	conn.SetReadDeadline(start.Add(10 * time.Second))
+	pings := 0
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if strings.Contains(string(frame), `"type":"ping"`) {
+			pings++
+		}
+	}
+
+	if pings == 0 {
+		t.Error("no ping received")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("silent connection closed after %v", elapsed)
+	}
+	if remaining := srv.waitConnections(0, 2*time.Second); remaining > 0 {
+		t.Errorf("%d connections still registered", remaining)
+	}
+}
@@ -0,0 +1,29 @@
+package ws
+
+import (
+	"go-websocket/internal/metrics"
+	"log/slog"
+)
+
+// Close code sent to clients disconnected for not reading their frames fast
+// enough, in the range reserved for applications
+const CloseSlowConsumer = 4008
+
+var slowConsumers = metrics.NewCounter(
+	"ws_slow_consumers_total",
+	"Connections evicted because their send buffer was full",
+)
+
+// evict disconnects a client whose send buffer is full. Broadcasts hold only
+// the bucket read lock, so this just marks the client and makes its WritePump
+// close the connection; ReadPump then unregisters it, which removes it from
+// the hub under the write lock. Marked clients are skipped by later broadcasts.
+func (h *Hub) evict(client *Client) {
+	if !client.evicted.CompareAndSwap(false, true) {
+		return
+	}
+
+	slog.Warn("[HUB] Client buffer full, disconnecting slow consumer", "user", client.userId, "channel", client.channelId)
+	slowConsumers.Inc()
+	client.close(CloseSlowConsumer, "slow consumer")
+}
@@ -0,0 +1,164 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"go-websocket/internal/models"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestEvictionStress races broadcasts against connects, disconnects, user
+// events and admin reads while some clients read too slowly to keep up. Every
+// slow client must be closed with CloseSlowConsumer, and no connection may stay
+// registered once the clients are gone. cmd/wsbench stress runs the same
+// scenario for longer and with more load.
+func TestEvictionStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+
+	const (
+		duration = time.Second
+		channels = 2
+		perTick  = 2
+		size     = 16 << 10
+		churners = 4
+		slow     = 2
+	)
+	channelId := func(i int) string { return fmt.Sprintf("channel_%d", i%channels) }
+
+	for _, mode := range []TransportMode{TransportGoroutines, TransportEpoll} {
+		t.Run(string(mode), func(t *testing.T) {
+			srv := newTestServer(t, Options{NodeId: "test", Transport: TransportOptions{Mode: mode}})
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+
+			// Slow clients trickle-read until the run ends, then drain to the
+			// close frame. They keep reading so the server's blocked write can
+			// finish and the close frame gets through.
+			slowCodes := make([]int, slow)
+			var slowWg sync.WaitGroup
+			for i := range slowCodes {
+				conn, err := srv.dial(fmt.Sprintf("slow_%d", i), channelId(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				slowWg.Add(1)
+				go func() {
+					defer slowWg.Done()
+					defer conn.Close()
+					for {
+						select {
+						case <-stop:
+							conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+						default:
+							time.Sleep(5 * time.Millisecond)
+						}
+
+						_, _, err := conn.ReadMessage()
+						if err == nil {
+							continue
+						}
+						var closeErr *websocket.CloseError
+						if errors.As(err, &closeErr) {
+							slowCodes[i] = closeErr.Code
+						} else {
+							t.Errorf("slow client %d: %v", i, err)
+						}
+						return
+					}
+				}()
+			}
+
+			// Publisher
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				payload := messageCreated(0, size)
+				ticker := time.NewTicker(time.Millisecond)
+				defer ticker.Stop()
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					case <-ticker.C:
+						for j := 0; j < perTick; j++ {
+							srv.hub.Broadcast(&models.BroadcastMessage{ChannelId: channelId(i + j), Payload: payload})
+						}
+					}
+				}
+			}()
+
+			// Churners connect, read a little, and leave cleanly or abruptly
+			for g := 0; g < churners; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rng := rand.New(rand.NewSource(int64(g)))
+					for i := 0; ; i++ {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+
+						conn, err := srv.dial(fmt.Sprintf("churn_%d_%d", g, i%4), channelId(rng.Intn(channels)))
+						if err != nil {
+							continue
+						}
+
+						conn.SetReadDeadline(time.Now().Add(time.Second))
+						for n := rng.Intn(20); n > 0; n-- {
+							if _, _, err := conn.ReadMessage(); err != nil {
+								break
+							}
+						}
+
+						if rng.Intn(2) == 0 {
+							conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+						}
+						conn.Close()
+					}
+				}()
+			}
+
+			// Admin reads and user events
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					srv.hub.Connections()
+					srv.hub.GetChannelUsers(channelId(i))
+					srv.hub.SendToUser(fmt.Sprintf("churn_%d_%d", i%churners, i%4), messageCreated(i, 128))
+					srv.hub.SendToUser(fmt.Sprintf("slow_%d", i%slow), messageCreated(i, 128))
+					time.Sleep(100 * time.Microsecond)
+				}
+			}()
+
+			time.Sleep(duration)
+			close(stop)
+			wg.Wait()
+			slowWg.Wait()
+
+			for i, code := range slowCodes {
+				if code != CloseSlowConsumer {
+					t.Errorf("slow client %d closed with %d, want %d", i, code, CloseSlowConsumer)
+				}
+			}
+			if remaining := srv.waitConnections(0, 10*time.Second); remaining > 0 {
+				t.Errorf("%d connections still registered", remaining)
+			}
+		})
+	}
+}
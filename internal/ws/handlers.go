@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/goccy/go-json"
+)
+
+// Request is a message sent by a client
+type Request struct {
+	// Optional correlation id, echoed back in the ack or error frame
+	Id   string          `json:"id,omitempty"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Error rejects a request with a code from the error catalog
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// CloseError rejects a request and closes the connection with the given close code
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return "close connection: " + e.Text
+}
+
+// ErrDrop rejects a request without notifying the client
+var ErrDrop = errors.New("ws: request dropped")
+
+// ErrDeferred tells the reader the handler answers the request itself, once
+// work it moved off the read path is done
+var ErrDeferred = errors.New("ws: request answered later")
+
+// HandlerFunc processes a request. The result is sent back in an ack frame
+// when the request carries an id; a returned error becomes an error frame.
+type HandlerFunc func(c *Client, req *Request) (interface{}, error)
+
+// Middleware wraps a handler, e.g. to authorize, rate limit or log requests
+type Middleware func(next HandlerFunc) HandlerFunc
+
+func (h *Hub) registerBuiltinHandlers() {
+	h.Use(h.rateLimit)
+
+	typingSchema := &Schema{
+		MaxSize: 1024,
+		Fields:  map[string]FieldType{"threadId": FieldString},
+	}
+	h.Handle("typing:start", Typed(handleTypingStart), WithSchema(typingSchema))
+	h.Handle("typing:stop", Typed(handleTypingStop), WithSchema(typingSchema))
+
+	h.registerMessageHandlers()
+	h.registerReceiptHandlers()
+	h.registerThreadHandlers()
+	h.registerWhisperHandlers()
+	h.registerHeartbeatHandlers()
+	h.registerReplayHandlers()
+}
+
+type typingRequest struct {
+	ThreadId string `json:"threadId,omitempty"`
+}
+
+func (r *typingRequest) threadId() *string {
+	if r.ThreadId == "" {
+		return nil
+	}
+	return &r.ThreadId
+}
+
+func handleTypingStart(c *Client, req *Request, data *typingRequest) (interface{}, error) {
+	if err := c.hub.redisClient.PublishTypingStart(c.channelId, c.userId, c.userName, data.threadId()); err != nil {
+		slog.Error("[CLIENT] Failed to publish typing:start", "user", c.userId, "channel", c.channelId, "error", err)
+		return nil, &Error{Code: ErrCodePublishFailed, Message: "Failed to publish 'typing:start'"}
+	}
+
+	return nil, nil
+}
+
+func handleTypingStop(c *Client, req *Request, data *typingRequest) (interface{}, error) {
+	if err := c.hub.redisClient.PublishTypingStop(c.channelId, c.userId, data.threadId()); err != nil {
+		slog.Error("[CLIENT] Failed to publish typing:stop", "user", c.userId, "channel", c.channelId, "error", err)
+		return nil, &Error{Code: ErrCodePublishFailed, Message: "Failed to publish 'typing:stop'"}
+	}
+
+	return nil, nil
+}
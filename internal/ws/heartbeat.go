@@ -0,0 +1,130 @@
+package ws
+
+import (
+	"go-websocket/internal/metrics"
+	"go-websocket/internal/models"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+)
+
+type HeartbeatOptions struct {
+	// Interval of JSON pings for clients connecting with ?heartbeat=app
+	AppInterval time.Duration
+}
+
+var heartbeatRTT = metrics.NewHistogram(
+	"ws_heartbeat_rtt_seconds",
+	"Round-trip time of heartbeat pings",
+	[]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+)
+
+// heartbeat is the per-connection heartbeat state, shared by both pumps
+type heartbeat struct {
+	// Clients that can't see control frames use JSON ping/pong instead
+	app bool
+
+	seq     atomic.Int64
+	sentAt  atomic.Int64
+	latency atomic.Int64
+}
+
+type pingData struct {
+	Seq int64 `json:"seq,omitempty"`
+	// Sender's clock in unix milliseconds, echoed back in the pong
+	Ts int64 `json:"ts,omitempty"`
+}
+
+// Latency returns the last measured heartbeat round-trip time
+func (c *Client) Latency() time.Duration {
+	return time.Duration(c.heartbeat.latency.Load())
+}
+
+// pingInterval returns how often the server pings this client
+func (c *Client) pingInterval() time.Duration {
+	if c.heartbeat.app {
+		return c.hub.opts.Heartbeat.AppInterval
+	}
+	return pingPeriod
+}
+
+// readTimeout returns how long the client may stay silent before it is
+// considered dead
+func (c *Client) readTimeout() time.Duration {
+	if c.heartbeat.app {
+		return c.hub.opts.Heartbeat.AppInterval * 2
+	}
+	return pongWait
+}
+
+// writePing sends a control ping, or a JSON ping for app heartbeat clients.
+// Both carry what is needed to measure the round trip when answered.
+func (c *Client) writePing() error {
+	now := time.Now()
+	c.conn.SetWriteDeadline(now.Add(writeWait))
+
+	if !c.heartbeat.app {
+		c.heartbeat.sentAt.Store(now.UnixNano())
+		return c.conn.WriteMessage(websocket.PingMessage, []byte(strconv.FormatInt(now.UnixNano(), 10)))
+	}
+
+	seq := c.heartbeat.seq.Add(1)
+	payload, err := json.Marshal(models.Event{
+		Type:      "ping",
+		ChannelId: c.channelId,
+		Timestamp: now.Unix(),
+		Data:      pingData{Seq: seq, Ts: now.UnixMilli()},
+	})
+	if err != nil {
+		return err
+	}
+
+	frame, err := c.protocol.Codec.Encode(payload)
+	if err != nil {
+		return err
+	}
+
+	c.setWriteCompression(len(frame))
+	c.heartbeat.sentAt.Store(now.UnixNano())
+	return c.conn.WriteMessage(c.protocol.Codec.MessageType(), frame)
+}
+
+// handleControlPong records the round trip of a control ping
+func (c *Client) handleControlPong(appData string) error {
+	c.conn.SetReadDeadline(time.Now().Add(c.readTimeout()))
+
+	if sentAt, err := strconv.ParseInt(appData, 10, 64); err == nil {
+		c.recordLatency(time.Since(time.Unix(0, sentAt)))
+	}
+	return nil
+}
+
+func (c *Client) recordLatency(rtt time.Duration) {
+	if rtt < 0 {
+		return
+	}
+	c.heartbeat.latency.Store(int64(rtt))
+	heartbeatRTT.Observe(rtt.Seconds())
+}
+
+func (h *Hub) registerHeartbeatHandlers() {
+	h.Handle("ping", Typed(handlePing))
+	h.Handle("pong", Typed(handlePong))
+}
+
+// handlePing answers a client's JSON ping so it can detect dead sockets
+func handlePing(c *Client, req *Request, data *pingData) (interface{}, error) {
+	c.sendEvent("pong", data)
+	return nil, nil
+}
+
+// handlePong measures the round trip of the server's last JSON ping
+func handlePong(c *Client, req *Request, data *pingData) (interface{}, error) {
+	if data.Seq != 0 && data.Seq == c.heartbeat.seq.Load() {
+		c.recordLatency(time.Since(time.Unix(0, c.heartbeat.sentAt.Load())))
+	}
+	return nil, nil
+}
@@ -0,0 +1,238 @@
+package ws
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"go-websocket/internal/auth"
+	"go-websocket/internal/models"
+	"go-websocket/internal/ws/wstest"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+func TestMain(m *testing.M) {
+	// Keep connection logs, errors included, out of the test output
+	slog.SetLogLoggerLevel(slog.LevelError + 1)
+	os.Exit(m.Run())
+}
+
+var (
+	testKey     *rsa.PrivateKey
+	testIssuer  string
+	testAuthErr error
+	testAuth    sync.Once
+)
+
+// setupAuth points the auth package at a local JWKS, once per test binary
+func setupAuth(tb testing.TB) {
+	testAuth.Do(func() {
+		testKey, testAuthErr = rsa.GenerateKey(rand.Reader, 2048)
+		if testAuthErr != nil {
+			return
+		}
+
+		jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := base64.RawURLEncoding.EncodeToString(testKey.N.Bytes())
+			e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(testKey.E)).Bytes())
+			fmt.Fprintf(w, `{"keys":[{"kid":"test","kty":"RSA","use":"sig","alg":"RS256","n":"%s","e":"%s"}]}`, n, e)
+		}))
+		testIssuer = jwks.URL
+		testAuthErr = auth.InitJWKS(jwks.URL)
+	})
+	if testAuthErr != nil {
+		tb.Fatal(testAuthErr)
+	}
+}
+
+func testToken(tb testing.TB, userId string) string {
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub":        userId,
+		"iss":        testIssuer,
+		"given_name": userId,
+		"exp":        time.Now().Add(time.Hour).Unix(),
+	})
+	t.Header["kid"] = "test"
+
+	// Safe to call from the test's goroutines, unlike Fatal
+	token, err := t.SignedString(testKey)
+	if err != nil {
+		tb.Error(err)
+	}
+	return token
+}
+
+// testServer serves a hub over real connections
+type testServer struct {
+	tb   testing.TB
+	hub  *Hub
+	http *httptest.Server
+
+	tokensMu sync.Mutex
+	tokens   map[string]string
+}
+
+func newTestServer(tb testing.TB, opts Options) *testServer {
+	setupAuth(tb)
+
+	hub := NewHub(wstest.NopPublisher{}, opts)
+	srv := &testServer{
+		tb:  tb,
+		hub: hub,
+		http: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ServeWS(hub, w, r)
+		})),
+		tokens: make(map[string]string),
+	}
+	tb.Cleanup(srv.http.Close)
+	return srv
+}
+
+// token returns a token for userId, cached since signing is slow
+func (s *testServer) token(userId string) string {
+	s.tokensMu.Lock()
+	defer s.tokensMu.Unlock()
+
+	token, ok := s.tokens[userId]
+	if !ok {
+		token = testToken(s.tb, userId)
+		s.tokens[userId] = token
+	}
+	return token
+}
+
+func (s *testServer) url(userId, channelId string) string {
+	return "ws" + strings.TrimPrefix(s.http.URL, "http") + "/ws?channelId=" + channelId + "&token=" + s.token(userId)
+}
+
+func (s *testServer) dial(userId, channelId string) (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(s.url(userId, channelId), nil)
+	return conn, err
+}
+
+// waitConnections waits until the hub lists n connections
+func (s *testServer) waitConnections(n int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	remaining := len(s.hub.Connections())
+	for remaining != n && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		remaining = len(s.hub.Connections())
+	}
+	return remaining
+}
+
+// discardConn accepts every write and counts them, so benchmarks measure
+// framing and compression rather than the network
+type discardConn struct {
+	writes atomic.Int64
+}
+
+func (c *discardConn) Read(p []byte) (int, error) { return 0, io.EOF }
+func (c *discardConn) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	return len(p), nil
+}
+func (c *discardConn) Close() error                       { return nil }
+func (c *discardConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *discardConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *discardConn) SetDeadline(t time.Time) error      { return nil }
+func (c *discardConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *discardConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// discardWriter is hijacked into a discardConn
+type discardWriter struct {
+	http.ResponseWriter
+	conn *discardConn
+}
+
+func (w discardWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
+
+// newDiscardClient upgrades a fake request the way ServeWS does, offering
+// permessage-deflate if compress is set, and adds the client to channelId
+// without a welcome frame. Its frames are only written by the test.
+func newDiscardClient(tb testing.TB, hub *Hub, channelId string, compress bool) (*Client, *discardConn) {
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if compress {
+		r.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate")
+	}
+
+	dc := &discardConn{}
+	conn, netConn, err := hub.upgrade(discardWriter{httptest.NewRecorder(), dc}, r)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	client := &Client{
+		id:        newConnectionId(),
+		hub:       hub,
+		conn:      conn,
+		netConn:   netConn,
+		send:      newSendQueue(nil),
+		policy:    hub.opts.Backpressure.policy(channelId),
+		done:      make(chan struct{}),
+		channelId: channelId,
+		userId:    "user_" + newConnectionId(),
+		limiter:   newClientLimiter(),
+		release:   func() {},
+		connected: time.Now(),
+		protocol:  defaultProtocol,
+		compress:  netConn.compressed,
+	}
+
+	b := hub.getBucket(channelId)
+	b.Lock()
+	if b.channels[channelId] == nil {
+		b.channels[channelId] = make(map[*Client]bool)
+	}
+	b.channels[channelId][client] = true
+	b.Unlock()
+
+	dc.writes.Store(0)
+	return client, dc
+}
+
+// messageCreated builds a message:created event of roughly size bytes
+func messageCreated(i, size int) []byte {
+	words := []string{"the", "release", "is", "ready", "for", "review", "and", "deploy", "tomorrow", "morning"}
+	var content strings.Builder
+	for j := 0; content.Len() < size; j++ {
+		content.WriteString(words[(i+j*7)%len(words)])
+		content.WriteByte(' ')
+	}
+
+	payload, _ := json.Marshal(models.Event{
+		Type:      models.EventMessageCreated,
+		ChannelId: "channel_test",
+		Timestamp: time.Now().Unix(),
+		Data: models.MessageCreatedData{
+			ID:         fmt.Sprintf("msg_%d", i),
+			Content:    content.String(),
+			AuthorId:   "user_test",
+			AuthorName: "Test",
+			CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+	return payload
+}
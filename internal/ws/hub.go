@@ -5,88 +5,122 @@ import (
 	"hash/fnv"
 	"log/slog"
 	"sync"
-)
+	"time"
 
-const numBuckets = 32
+	"github.com/gorilla/websocket"
+)
 
 type RedisPublisher interface {
+	PublishMessageCreated(channelId string, message interface{}) error
 	PublishPresenceJoin(channelId, userId, userName string) error
 	PublishPresenceLeave(channelId, userId string) error
 	PublishTypingStart(channelId, userId, userName string, threadId *string) error
 	PublishTypingStop(channelId, userId string, threadId *string) error
+	PublishWhisper(channelId, eventType, senderConnectionId string, whisper *models.WhisperData) error
+	PublishReadUpdated(channelId string, receipt *models.ReadReceiptData, toUserId string) error
+	PublishUnreadUpdated(userId, channelId string, count int64) error
+	AddChannelMember(channelId, userId string) error
+	SetReadCursor(channelId, userId, messageId string) error
+	GetMessage(messageId string) (channelId, authorId string, err error)
+	GetUnreadCounts(userId string) (map[string]int64, error)
+	AllowRate(key string, limit int, period time.Duration) (bool, error)
+	GetHistory(channelId string, fromSeq, toSeq int64, limit int) ([]*models.BroadcastMessage, error)
 }
 
-type bucket struct {
-	sync.RWMutex
-	channels  map[string]map[*Client]bool
-	broadcast chan *models.BroadcastMessage
+type Options struct {
+	// Identifies this server in welcome frames
+	NodeId string
+
+	RateLimit    RateLimitOptions
+	Admission    AdmissionOptions
+	Messages     MessageOptions
+	Receipts     ReceiptOptions
+	Whisper      WhisperOptions
+	Heartbeat    HeartbeatOptions
+	Compression  CompressionOptions
+	Coalesce     CoalesceOptions
+	Backpressure BackpressureOptions
+	Buckets      BucketOptions
+	Replay       ReplayOptions
+	Transport    TransportOptions
 }
 
 type Hub struct {
-	buckets     [numBuckets]*bucket
-	register    chan *Client
-	unregister  chan *Client
-	Broadcast   chan *models.BroadcastMessage
+	buckets     []*bucket
 	redisClient RedisPublisher
+	opts        Options
+	admission   *admission
+
+	// Watches event loop connections; nil when connections own goroutines
+	poller     poller
+	heartbeats heartbeatWheel
+
+	// Connections of each user on this node, for events sent to a user
+	usersMu sync.RWMutex
+	users   map[string]map[*Client]bool
+
+	handlersMu sync.RWMutex
+	handlers   map[string]*route
+	middleware []Middleware
 }
 
-func NewHub(redisClient RedisPublisher) *Hub {
+func NewHub(redisClient RedisPublisher, opts Options) *Hub {
+	if opts.Buckets.Count <= 0 {
+		opts.Buckets.Count = defaultBuckets
+	}
+	if opts.Buckets.QueueSize <= 0 {
+		opts.Buckets.QueueSize = defaultBucketQueueSize
+	}
+
 	h := &Hub{
-		register:    make(chan *Client),
-		unregister:  make(chan *Client),
-		Broadcast:   make(chan *models.BroadcastMessage),
+		buckets:     make([]*bucket, opts.Buckets.Count),
 		redisClient: redisClient,
+		opts:        opts,
+		admission:   newAdmission(opts.Admission),
+		handlers:    make(map[string]*route),
+		users:       make(map[string]map[*Client]bool),
 	}
+	h.registerBuiltinHandlers()
 
-	for i := 0; i < numBuckets; i++ {
+	for i := range h.buckets {
 		h.buckets[i] = &bucket{
-			channels:  make(map[string]map[*Client]bool),
-			broadcast: make(chan *models.BroadcastMessage, 256),
+			channels: make(map[string]map[*Client]bool),
+			queue:    newBroadcastQueue(opts.Buckets.QueueSize),
 		}
 		go h.runBucketWorker(i)
 	}
 
+	if opts.Transport.Mode == TransportEpoll {
+		p, err := newPoller(func(c *Client) { go c.readEvents() })
+		if err != nil {
+			slog.Error("[HUB] Event loop unavailable, connections will own goroutines", "error", err)
+		} else {
+			h.poller = p
+			go h.runHeartbeats()
+		}
+	}
+	slog.Info("[HUB] Started", "buckets", len(h.buckets), "eventLoop", h.poller != nil)
+
 	return h
 }
 
 func (h *Hub) getBucket(channelId string) *bucket {
 	hash := fnv.New32a()
 	hash.Write([]byte(channelId))
-	return h.buckets[hash.Sum32()%numBuckets]
-}
-
-func (h *Hub) Run() {
-	slog.Info("[HUB] Started event loop", "buckets", numBuckets)
-	for {
-		select {
-		case client := <-h.register:
-			h.registerClient(client)
-
-		case client := <-h.unregister:
-			h.unregisterClient(client)
-
-		case message := <-h.Broadcast:
-			b := h.getBucket(message.ChannelId)
-			select {
-			case b.broadcast <- message:
-			default:
-				slog.Warn("[HUB] Broadcast channel full, dropping message", "channel", message.ChannelId)
-			}
-		}
-	}
+	return h.buckets[hash.Sum32()%uint32(len(h.buckets))]
 }
 
-func (h *Hub) runBucketWorker(bucketIndex int) {
-	slog.Info("[HUB] Starting bucket worker", "bucket", bucketIndex)
-	b := h.buckets[bucketIndex]
-
-	for message := range b.broadcast {
-		h.broadcastToChannel(message)
+// Broadcast queues a message for the worker of its channel's bucket. It
+// never blocks; if the queue is full, a message is dropped.
+func (h *Hub) Broadcast(message *models.BroadcastMessage) {
+	if !h.getBucket(message.ChannelId).queue.push(message) {
+		slog.Warn("[HUB] Broadcast queue full, dropping message", "type", message.Type, "channel", message.ChannelId)
+		droppedBroadcasts.Inc()
 	}
-
-	slog.Info("[HUB] Bucket worker stopped", "bucket", bucketIndex)
 }
 
+// registerClient adds a client to its channel. It runs on the connection's
+// goroutine, so slow Redis calls only hold up this connection.
 func (h *Hub) registerClient(client *Client) {
 	b := h.getBucket(client.channelId)
 	b.Lock()
@@ -96,11 +130,20 @@ func (h *Hub) registerClient(client *Client) {
 	}
 	b.channels[client.channelId][client] = true
 
+	// Queued under the bucket lock so it precedes any broadcast
+	h.sendWelcome(client)
+
 	clientCount := len(b.channels[client.channelId])
 	slog.Info("[HUB] Client registered", "user", client.userId, "channel", client.channelId, "clients", clientCount)
 
 	b.Unlock()
 
+	h.addUser(client)
+
+	if err := h.redisClient.AddChannelMember(client.channelId, client.userId); err != nil {
+		slog.Error("[HUB] Failed to add channel member", "user", client.userId, "channel", client.channelId, "error", err)
+	}
+
 	if err := h.redisClient.PublishPresenceJoin(client.channelId, client.userId, client.userName); err != nil {
 		slog.Error("[HUB] Failed to publish presence:join", "user", client.userId, "channel", client.channelId, "error", err)
 	}
@@ -114,7 +157,8 @@ func (h *Hub) unregisterClient(client *Client) {
 	if clients, ok := b.channels[client.channelId]; ok {
 		if _, ok := clients[client]; ok {
 			delete(clients, client)
-			close(client.send)
+			h.removeUser(client)
+			client.close(websocket.CloseNormalClosure, "")
 
 			clientCount := len(clients)
 			slog.Info("[HUB] Client unregistered", "user", client.userId, "channel", client.channelId, "clients", clientCount)
@@ -142,18 +186,99 @@ func (h *Hub) broadcastToChannel(message *models.BroadcastMessage) {
 	defer b.RUnlock()
 
 	if clients, ok := b.channels[message.ChannelId]; ok {
+		frames := frameCache{}
+		var skip []byte
 		for client := range clients {
-			select {
-			case client.send <- message.Payload:
-			default:
-				slog.Warn("[HUB] Client buffer full, disconnecting", "user", client.userId, "channel", client.channelId)
-				close(client.send)
-				delete(clients, client)
+			if client.evicted.Load() {
+				continue
+			}
+
+			payload, p := client.payload(message), eventPriority(message.Type)
+			if payload == nil {
+				if message.Seq == 0 {
+					continue
+				}
+				// Tell the client the number is taken, so it sees no gap
+				if skip == nil {
+					skip = skipPayload(message)
+				}
+				payload, p = skip, priorityLow
+			}
+
+			frame, err := frames.prepare(client.protocol, payload)
+			if err != nil {
+				slog.Error("[HUB] Failed to encode event", "protocol", client.protocol.Name, "channel", message.ChannelId, "error", err)
+				continue
+			}
+
+			frame.priority = p
+			frame.key = message.Key
+			if client.send.push(frame, client.policy) == pushOverflow {
+				h.evict(client)
 			}
 		}
 	}
 }
 
+// payload returns the payload of a broadcast for this client, or nil if the
+// client doesn't get it
+func (c *Client) payload(message *models.BroadcastMessage) []byte {
+	if c.id == message.ExcludeConnectionId || c.userId == message.ExcludeUserId {
+		return nil
+	}
+
+	payload := message.Payload
+	if message.UserPayload != nil && c.userId == message.UserId {
+		payload = message.UserPayload
+	}
+
+	if message.ThreadId != "" && !c.inThread(message.ThreadId) {
+		payload = message.ActivityPayload
+	}
+	return payload
+}
+
+func (h *Hub) addUser(client *Client) {
+	h.usersMu.Lock()
+	defer h.usersMu.Unlock()
+
+	if h.users[client.userId] == nil {
+		h.users[client.userId] = make(map[*Client]bool)
+	}
+	h.users[client.userId][client] = true
+}
+
+func (h *Hub) removeUser(client *Client) {
+	h.usersMu.Lock()
+	defer h.usersMu.Unlock()
+
+	if clients, ok := h.users[client.userId]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.users, client.userId)
+		}
+	}
+}
+
+// SendToUser delivers a payload to every connection of a user on this node
+func (h *Hub) SendToUser(userId string, payload []byte) {
+	h.usersMu.RLock()
+	defer h.usersMu.RUnlock()
+
+	frames := frameCache{}
+	for client := range h.users[userId] {
+		frame, err := frames.prepare(client.protocol, payload)
+		if err != nil {
+			slog.Error("[HUB] Failed to encode event", "protocol", client.protocol.Name, "user", userId, "error", err)
+			continue
+		}
+
+		if result := client.send.push(frame, BackpressureDropNewest); result == pushDroppedNew || result == pushOverflow {
+			slog.Warn("[HUB] Client buffer full, dropping user event", "user", client.userId, "channel", client.channelId)
+		}
+	}
+}
+
 func (h *Hub) GetChannelUsers(channelId string) []string {
 	b := h.getBucket(channelId)
 	b.RLock()
@@ -0,0 +1,133 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/internal/models"
+	"go-websocket/internal/ws/wstest"
+	"slices"
+	"testing"
+
+	"github.com/goccy/go-json"
+)
+
+// BenchmarkBroadcastPrepared writes one event to every connection of a
+// channel, with a frame per connection as WritePump did before prepared
+// messages, and with a prepared message shared by all connections
+func BenchmarkBroadcastPrepared(b *testing.B) {
+	const conns = 1000
+
+	for _, compress := range []bool{false, true} {
+		hub := NewHub(wstest.NopPublisher{}, Options{
+			Compression: CompressionOptions{Enabled: compress, Level: 1},
+		})
+		clients := make([]*Client, conns)
+		for i := range clients {
+			clients[i], _ = newDiscardClient(b, hub, "channel_bench", compress)
+		}
+		payload := messageCreated(0, 2048)
+
+		modes := []struct {
+			name   string
+			fanOut func() error
+		}{
+			{"per-connection", func() error {
+				for _, client := range clients {
+					if err := client.write(outbound{data: payload}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}},
+			{"prepared", func() error {
+				frames := frameCache{}
+				for _, client := range clients {
+					frame, err := frames.prepare(client.protocol, payload)
+					if err != nil {
+						return err
+					}
+					if err := client.write(frame); err != nil {
+						return err
+					}
+				}
+				return nil
+			}},
+		}
+
+		for _, mode := range modes {
+			b.Run(fmt.Sprintf("%s/compress=%v", mode.name, compress), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if err := mode.fanOut(); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*conns), "ns/conn")
+			})
+		}
+	}
+}
+
+func TestBroadcastSkipMarkers(t *testing.T) {
+	hub := NewHub(wstest.NopPublisher{}, Options{})
+	sender, _ := newDiscardClient(t, hub, "channel_test", false)
+	other, _ := newDiscardClient(t, hub, "channel_test", false)
+
+	tests := []struct {
+		name    string
+		message *models.BroadcastMessage
+		// Event types queued for the sender and the other client
+		sender, other []string
+	}{
+		{
+			name:    "excluded connection",
+			message: &models.BroadcastMessage{Type: models.EventMessageCreated, Seq: 5, ExcludeConnectionId: sender.id},
+			sender:  []string{models.EventSeqSkip},
+			other:   []string{models.EventMessageCreated},
+		},
+		{
+			name:    "excluded user",
+			message: &models.BroadcastMessage{Type: models.EventReadUpdated, Seq: 6, ExcludeUserId: other.userId},
+			sender:  []string{models.EventReadUpdated},
+			other:   []string{models.EventSeqSkip},
+		},
+		{
+			name:    "thread event without activity",
+			message: &models.BroadcastMessage{Type: models.EventMessageUpdated, Seq: 7, ThreadId: "thread_1"},
+			sender:  []string{models.EventSeqSkip},
+			other:   []string{models.EventSeqSkip},
+		},
+		{
+			name:    "ephemeral events have no number to skip",
+			message: &models.BroadcastMessage{Type: models.EventTypingStart, ExcludeConnectionId: sender.id},
+			other:   []string{models.EventTypingStart},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.message.ChannelId = "channel_test"
+			tt.message.Payload, _ = json.Marshal(models.Event{Type: tt.message.Type, ChannelId: "channel_test", Seq: tt.message.Seq})
+			hub.broadcastToChannel(tt.message)
+
+			for _, c := range []struct {
+				client *Client
+				want   []string
+			}{{sender, tt.sender}, {other, tt.other}} {
+				var got []string
+				for _, frame := range c.client.send.pop(nil, sendQueueSize) {
+					var event models.Event
+					if err := json.Unmarshal(frame.data, &event); err != nil {
+						t.Fatal(err)
+					}
+					if event.Seq != tt.message.Seq {
+						t.Errorf("%s got seq %d, want %d", event.Type, event.Seq, tt.message.Seq)
+					}
+					got = append(got, event.Type)
+				}
+				if !slices.Equal(got, c.want) {
+					t.Errorf("queued %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package ws
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newConnectionId returns a random id, unique across the cluster
+func newConnectionId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "conn_" + hex.EncodeToString(b)
+}
@@ -4,6 +4,9 @@ import (
 	"go-websocket/internal/auth"
 	"log/slog"
 	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
@@ -48,26 +51,73 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	// TODO: Verify user has access to this channel
 	// Could call Next.js API or query Postgres directly
 
+	// Pick the wire format the client asked for
+	protocol := negotiateProtocol(r)
+	if protocol == nil {
+		slog.Warn("[WS] Unsupported protocol requested", "user", claims.Subject, "protocols", websocket.Subprotocols(r))
+		rejectProtocol(w, r)
+		return
+	}
+
+	// Enforce connection limits before upgrading
+	ip := clientIP(r, hub.opts.Admission.TrustedProxies)
+	release, reason := hub.admission.acquire(claims.Subject, ip)
+	if release == nil {
+		slog.Warn("[WS] Connection rejected by admission limits", "reason", reason, "user", claims.Subject, "ip", ip)
+		hub.admission.reject(w, reason)
+		return
+	}
+
 	// Upgrade to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, netConn, err := hub.upgrade(w, r)
 	if err != nil {
 		slog.Error("[WS] Failed to upgrade connection", "user", claims.Subject, "channel", channelId, "error", err)
+		release()
 		return
 	}
 
-	slog.Info("[WS] Connection upgraded successfully", "user", claims.Subject, "channel", channelId)
+	slog.Info("[WS] Connection upgraded successfully", "user", claims.Subject, "channel", channelId, "compression", netConn.compressed)
 
 	client := &Client{
-		hub:       hub,
-		conn:      conn,
-		send:      make(chan []byte, 256),
-		channelId: channelId,
-		userId:    claims.Subject,
-		userName:  claims.GivenName,
+		id:         newConnectionId(),
+		hub:        hub,
+		conn:       conn,
+		netConn:    netConn,
+		send:       newSendQueue(nil),
+		policy:     hub.opts.Backpressure.policy(channelId),
+		done:       make(chan struct{}),
+		channelId:  channelId,
+		userId:     claims.Subject,
+		userName:   claims.GivenName,
+		userEmail:  claims.Email,
+		userAvatar: claims.Picture,
+		limiter:    newClientLimiter(),
+		release:    release,
+		connected:  time.Now(),
+		protocol:   protocol,
+		compress:   netConn.compressed,
 	}
+	client.heartbeat.app = r.URL.Query().Get("heartbeat") == "app" && hub.opts.Heartbeat.AppInterval > 0
 
-	slog.Debug("[WS] Client created, sending register request", "user", client.userId, "channel", client.channelId)
-	client.hub.register <- client
+	// The limit announced in the welcome frame, for both transports
+	conn.SetReadLimit(maxMessageSize)
+
+	// Event loop connections start no goroutines; the poller starts a reader
+	// when they have something to read, and queueing frames starts a writer
+	eventLoop := hub.poller != nil && client.useEventLoop()
+	if eventLoop {
+		// Idle until the poller reports data; connections that fall back to
+		// ReadPump keep the reader taken at the upgrade
+		netConn.releaseReader()
+	}
+
+	slog.Debug("[WS] Client created, registering", "user", client.userId, "channel", client.channelId, "eventLoop", eventLoop)
+	client.hub.registerClient(client)
+
+	if eventLoop {
+		hub.watch(client)
+		return
+	}
 
 	// Start goroutines for read/write
 	slog.Debug("[WS] Starting WritePump and ReadPump goroutines", "user", client.userId, "channel", client.channelId)
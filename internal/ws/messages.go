@@ -0,0 +1,190 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/internal/models"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	maxImageUrlLength = 2048
+	maxThreadIdLength = 128
+	maxNonceLength    = 64
+
+	// message:send requests a connection may have waiting for the store,
+	// including the one being stored
+	maxPendingSaves = 16
+)
+
+// MessageStore persists client-originated messages and returns them with
+// their server-assigned id
+type MessageStore interface {
+	SaveMessage(draft *models.MessageDraft) (*models.MessageCreatedData, error)
+}
+
+type MessageOptions struct {
+	// Where message:send is persisted; the event is disabled if nil
+	Store MessageStore
+
+	// Maximum content length in characters
+	MaxContentLength int
+}
+
+type messageSendRequest struct {
+	Content  string `json:"content"`
+	ImageUrl string `json:"imageUrl,omitempty"`
+	ThreadId string `json:"threadId,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+}
+
+func (h *Hub) registerMessageHandlers() {
+	if h.opts.Messages.Store == nil {
+		return
+	}
+
+	h.Handle("message:send", Typed(h.handleMessageSend), WithSchema(&Schema{
+		Fields: map[string]FieldType{
+			"content":  FieldString,
+			"imageUrl": FieldString,
+			"threadId": FieldString,
+			"nonce":    FieldString,
+		},
+		Strict: true,
+	}))
+}
+
+func (h *Hub) validateMessageSend(data *messageSendRequest) error {
+	data.Content = strings.TrimSpace(data.Content)
+
+	if data.Content == "" && data.ImageUrl == "" {
+		return &Error{Code: ErrCodeInvalidPayload, Message: "Message needs content or an image"}
+	}
+
+	if max := h.opts.Messages.MaxContentLength; max > 0 && utf8.RuneCountInString(data.Content) > max {
+		return &Error{Code: ErrCodeInvalidPayload, Message: fmt.Sprintf("Content exceeds %d characters", max)}
+	}
+
+	if data.ImageUrl != "" {
+		u, err := url.Parse(data.ImageUrl)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(data.ImageUrl) > maxImageUrlLength {
+			return &Error{Code: ErrCodeInvalidPayload, Message: "Invalid imageUrl"}
+		}
+	}
+
+	if len(data.ThreadId) > maxThreadIdLength {
+		return &Error{Code: ErrCodeInvalidPayload, Message: "Invalid threadId"}
+	}
+
+	if len(data.Nonce) > maxNonceLength {
+		return &Error{Code: ErrCodeInvalidPayload, Message: "Invalid nonce"}
+	}
+
+	return nil
+}
+
+// messageSaves queues the messages of one connection for the store. The store
+// may wait on a webhook for seconds, so messages are saved by a goroutine
+// that runs while the queue is non-empty, keeping the reader free for later
+// frames and pongs, and the messages in order.
+type messageSaves struct {
+	mu      sync.Mutex
+	queue   []pendingSave
+	running bool
+}
+
+type pendingSave struct {
+	requestId string
+	nonce     string
+	draft     *models.MessageDraft
+}
+
+// handleMessageSend queues a client message to be persisted, broadcast as
+// message:created and acked with the stored message id
+func (h *Hub) handleMessageSend(c *Client, req *Request, data *messageSendRequest) (interface{}, error) {
+	if err := h.validateMessageSend(data); err != nil {
+		return nil, err
+	}
+
+	save := pendingSave{
+		requestId: req.Id,
+		nonce:     data.Nonce,
+		draft: &models.MessageDraft{
+			ChannelId:    c.channelId,
+			ThreadId:     data.ThreadId,
+			Content:      data.Content,
+			ImageUrl:     data.ImageUrl,
+			AuthorId:     c.userId,
+			AuthorName:   c.userName,
+			AuthorEmail:  c.userEmail,
+			AuthorAvatar: c.userAvatar,
+		},
+	}
+
+	c.saves.mu.Lock()
+	if len(c.saves.queue) >= maxPendingSaves {
+		c.saves.mu.Unlock()
+		return nil, &Error{Code: ErrCodeRateLimited, Message: "Too many messages waiting to be stored"}
+	}
+	c.saves.queue = append(c.saves.queue, save)
+	start := !c.saves.running
+	c.saves.running = true
+	c.saves.mu.Unlock()
+
+	if start {
+		go h.runMessageSaves(c)
+	}
+	return nil, ErrDeferred
+}
+
+// runMessageSaves stores queued messages until the queue is empty, answering
+// each request like the reader would have
+func (h *Hub) runMessageSaves(c *Client) {
+	c.saves.mu.Lock()
+	for len(c.saves.queue) > 0 {
+		save := c.saves.queue[0]
+		c.saves.mu.Unlock()
+
+		result, err := h.saveMessage(c, save)
+		switch {
+		case err != nil:
+			c.sendError(err.Code, err.Message, save.requestId)
+		case save.requestId != "":
+			c.sendEvent("ack", models.AckData{Id: save.requestId, Result: result})
+		}
+
+		// Stays queued until stored, so it counts towards maxPendingSaves
+		c.saves.mu.Lock()
+		c.saves.queue[0] = pendingSave{}
+		c.saves.queue = c.saves.queue[1:]
+	}
+	c.saves.running = false
+	c.saves.mu.Unlock()
+}
+
+// saveMessage persists a message and broadcasts it as message:created
+func (h *Hub) saveMessage(c *Client, save pendingSave) (map[string]string, *Error) {
+	created, err := h.opts.Messages.Store.SaveMessage(save.draft)
+	if err != nil {
+		slog.Error("[CLIENT] Failed to persist message", "user", c.userId, "channel", c.channelId, "error", err)
+		return nil, &Error{Code: ErrCodePersistFailed, Message: "Failed to store message"}
+	}
+	created.Nonce = save.nonce
+	if created.ThreadId == "" {
+		created.ThreadId = save.draft.ThreadId
+	}
+
+	if err := h.redisClient.PublishMessageCreated(c.channelId, created); err != nil {
+		slog.Error("[CLIENT] Failed to publish message:created", "user", c.userId, "channel", c.channelId, "message", created.ID, "error", err)
+		return nil, &Error{Code: ErrCodePublishFailed, Message: "Message stored but not broadcast"}
+	}
+
+	result := map[string]string{"id": created.ID}
+	if save.nonce != "" {
+		result["nonce"] = save.nonce
+	}
+	return result, nil
+}
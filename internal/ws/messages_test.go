@@ -0,0 +1,94 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/internal/models"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+)
+
+// blockingStore holds every save until release is closed
+type blockingStore struct {
+	release chan struct{}
+}
+
+func (s *blockingStore) SaveMessage(draft *models.MessageDraft) (*models.MessageCreatedData, error) {
+	<-s.release
+	return &models.MessageCreatedData{ID: "msg_" + draft.Content, Content: draft.Content}, nil
+}
+
+// TestMessageSendOffReadPath checks that a slow store neither holds up later
+// requests nor reorders messages, and that the queue of waiting messages is
+// bounded
+func TestMessageSendOffReadPath(t *testing.T) {
+	store := &blockingStore{release: make(chan struct{})}
+	srv := newTestServer(t, Options{Messages: MessageOptions{Store: store}})
+
+	conn, err := srv.dial("user_a", "channel_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Welcome frame
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// maxPendingSaves messages waiting for the store, and one rejected
+	for i := 0; i <= maxPendingSaves; i++ {
+		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"id":"send_%d","type":"message:send","data":{"content":"%d"}}`, i, i)))
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"ping","type":"ping"}`))
+
+	var order []string
+	released := false
+	for len(order) < maxPendingSaves+2 {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var event struct {
+			Type string `json:"type"`
+			Data struct {
+				Id     string            `json:"id"`
+				Code   string            `json:"code"`
+				Result map[string]string `json:"result"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(frame, &event); err != nil {
+			t.Fatal(err)
+		}
+
+		switch event.Type {
+		case "ack", "error":
+			order = append(order, event.Type+":"+event.Data.Id)
+		default:
+			continue
+		}
+		if event.Type == "error" && event.Data.Code != ErrCodeRateLimited {
+			t.Errorf("%s rejected with %s", event.Data.Id, event.Data.Code)
+		}
+		if event.Type == "ack" && event.Data.Id != "ping" && event.Data.Result["id"] != "msg_"+event.Data.Id[len("send_"):] {
+			t.Errorf("%s acked with %v", event.Data.Id, event.Data.Result)
+		}
+
+		// Stores once the requests after the saves were answered
+		if !released && event.Data.Id == "ping" {
+			released = true
+			close(store.release)
+		}
+	}
+
+	want := []string{fmt.Sprintf("error:send_%d", maxPendingSaves), "ack:ping"}
+	for i := 0; i < maxPendingSaves; i++ {
+		want = append(want, fmt.Sprintf("ack:send_%d", i))
+	}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("answers = %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,170 @@
+package ws
+
+import (
+	"bufio"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Corked writes are flushed early once this many bytes are held back
+const maxCorkedBytes = 64 * 1024
+
+// netConn is the network connection under a client's WebSocket. It counts
+// the bytes written by compressed connections and can hold back writes while
+// corked, to send several frames with one write.
+type netConn struct {
+	net.Conn
+
+	// gorilla serializes its own writes, but uncork runs outside of them
+	mu         sync.Mutex
+	compressed bool
+	corked     bool
+	buf        []byte
+
+	// Read buffer of event loop connections, which need to know whether
+	// frames are left in it; gorilla allocates its own otherwise. gorilla
+	// keeps reading through reader, but its buffer is only held while the
+	// connection is read: see takeReader.
+	reader *bufio.Reader
+	pooled *bufio.Reader
+}
+
+// Read buffers of event loop connections between their reads
+var readerPool = sync.Pool{
+	New: func() interface{} { return bufio.NewReaderSize(nil, upgrader.ReadBufferSize) },
+}
+
+// takeReader gives reader a buffer from the pool, unless it still holds one
+func (c *netConn) takeReader() {
+	if c.pooled != nil {
+		return
+	}
+	c.pooled = readerPool.Get().(*bufio.Reader)
+	c.pooled.Reset(c)
+	*c.reader = *c.pooled
+}
+
+// releaseReader returns the buffer of reader to the pool if nothing is left in
+// it. Reading the connection before the next takeReader would panic.
+func (c *netConn) releaseReader() {
+	if c.pooled == nil || c.reader.Buffered() > 0 {
+		return
+	}
+	*c.reader = bufio.Reader{}
+	readerPool.Put(c.pooled)
+	c.pooled = nil
+}
+
+func (c *netConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.corked {
+		return c.write(p)
+	}
+
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= maxCorkedBytes {
+		if err := c.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *netConn) write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if c.compressed {
+		compressionWireBytes.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *netConn) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	_, err := c.write(c.buf)
+	// Bursts are rare; don't keep their buffer around on idle connections
+	c.buf = nil
+	return err
+}
+
+func (c *netConn) cork() {
+	c.mu.Lock()
+	c.corked = true
+	c.mu.Unlock()
+}
+
+// uncork sends the writes held back since cork
+func (c *netConn) uncork() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.corked = false
+	return c.flush()
+}
+
+// hijackResponseWriter hands the upgrader a netConn when it hijacks the
+// connection, and a pooled read buffer if pooled is set
+type hijackResponseWriter struct {
+	http.ResponseWriter
+	conn   *netConn
+	pooled bool
+}
+
+func (w *hijackResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn = &netConn{Conn: conn}
+
+	// The upgrader rejects clients that sent data early; keep what they sent
+	// in brw for it to see
+	if w.pooled && brw.Reader.Buffered() == 0 {
+		w.conn.reader = new(bufio.Reader)
+		w.conn.takeReader()
+		brw = bufio.NewReadWriter(w.conn.reader, brw.Writer)
+	}
+	return w.conn, brw, nil
+}
+
+// upgrade upgrades the connection, negotiating compression if enabled and
+// offered by the client
+func (h *Hub) upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, *netConn, error) {
+	u := upgrader
+	u.EnableCompression = h.opts.Compression.Enabled && offersDeflate(r)
+	if h.opts.Transport.DedicatedWriteBuffers {
+		u.WriteBufferPool = nil
+	}
+
+	hw := &hijackResponseWriter{ResponseWriter: w}
+	if h.poller != nil {
+		// The upgrader reuses the hijacked reader, reset onto the connection,
+		// when its own buffer size is 0
+		u.ReadBufferSize = 0
+		hw.pooled = true
+	}
+
+	conn, err := u.Upgrade(hw, r, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.EnableCompression {
+		if err := conn.SetCompressionLevel(h.opts.Compression.Level); err != nil {
+			slog.Warn("[WS] Invalid compression level, using the default", "level", h.opts.Compression.Level, "error", err)
+		}
+
+		// Only count frames, not the handshake
+		hw.conn.mu.Lock()
+		hw.conn.compressed = true
+		hw.conn.mu.Unlock()
+	}
+
+	return conn, hw.conn, nil
+}
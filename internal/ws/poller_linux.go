@@ -0,0 +1,101 @@
+//go:build linux
+
+package ws
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"syscall"
+)
+
+// Connections are reported once until rearmed, so only one goroutine reads
+// a connection at a time
+const epollEvents = syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT
+
+// epoll watches connections with one epoll instance and a single goroutine
+// waiting on it
+type epoll struct {
+	fd         int
+	onReadable func(c *Client)
+
+	mu      sync.RWMutex
+	clients map[int]*Client
+}
+
+func newPoller(onReadable func(c *Client)) (poller, error) {
+	fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &epoll{fd: fd, onReadable: onReadable, clients: make(map[int]*Client)}
+	go p.wait()
+	return p, nil
+}
+
+func (p *epoll) add(c *Client) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if c.loop.fd < 0 {
+		return errors.New("connection already removed")
+	}
+	if err := syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_ADD, c.loop.fd, p.event(c)); err != nil {
+		return err
+	}
+	p.clients[c.loop.fd] = c
+	return nil
+}
+
+func (p *epoll) rearm(c *Client) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// Torn down meanwhile; the descriptor may already belong to another one
+	if c.loop.fd < 0 || p.clients[c.loop.fd] != c {
+		return nil
+	}
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_MOD, c.loop.fd, p.event(c))
+}
+
+// remove stops watching a connection; it must run before the connection is
+// closed, as closing frees the descriptor for reuse
+func (p *epoll) remove(c *Client) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	watched := c.loop.fd >= 0 && p.clients[c.loop.fd] == c
+	if watched {
+		syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_DEL, c.loop.fd, nil)
+		delete(p.clients, c.loop.fd)
+	}
+	c.loop.fd = -1
+	return watched
+}
+
+func (p *epoll) event(c *Client) *syscall.EpollEvent {
+	return &syscall.EpollEvent{Events: epollEvents, Fd: int32(c.loop.fd), Pad: int32(c.loop.tag)}
+}
+
+func (p *epoll) wait() {
+	events := make([]syscall.EpollEvent, 256)
+	for {
+		n, err := syscall.EpollWait(p.fd, events, -1)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			slog.Error("[HUB] epoll wait failed", "error", err)
+			return
+		}
+
+		p.mu.RLock()
+		for _, event := range events[:n] {
+			if c := p.clients[int(event.Fd)]; c != nil && int32(c.loop.tag) == event.Pad {
+				p.onReadable(c)
+			}
+		}
+		p.mu.RUnlock()
+	}
+}
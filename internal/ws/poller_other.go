@@ -0,0 +1,9 @@
+//go:build !linux
+
+package ws
+
+import "errors"
+
+func newPoller(onReadable func(c *Client)) (poller, error) {
+	return nil, errors.New("the epoll transport requires Linux")
+}
@@ -0,0 +1,164 @@
+package ws
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+)
+
+// Codec converts between the server's internal JSON events and a wire format
+type Codec interface {
+	// WebSocket frame type used on the wire
+	MessageType() int
+
+	// Encode converts a JSON event to a frame
+	Encode(event []byte) ([]byte, error)
+
+	// Decode converts a client frame to a JSON request
+	Decode(frame []byte) ([]byte, error)
+}
+
+// Protocol is a version of the wire format, negotiated as a WebSocket subprotocol
+type Protocol struct {
+	Name    string
+	Version int
+	Codec   Codec
+}
+
+var (
+	protocolV1JSON = &Protocol{Name: "gows.v1.json", Version: 1, Codec: jsonV1Codec{}}
+	protocolV2JSON = &Protocol{Name: "gows.v2.json", Version: 2, Codec: jsonV2Codec{}}
+)
+
+// Supported protocols, in order of preference. Clients that don't request a
+// subprotocol speak v1 JSON.
+var protocols = []*Protocol{
+	protocolV2Proto,
+	protocolV2MsgPack,
+	protocolV2CBOR,
+	protocolV2JSON,
+	protocolV1JSON,
+}
+
+var defaultProtocol = protocolV1JSON
+
+func protocolNames() []string {
+	names := make([]string, len(protocols))
+	for i, p := range protocols {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// negotiateProtocol picks the preferred protocol among those requested by the
+// client. It returns nil if the client only requested unsupported ones.
+func negotiateProtocol(r *http.Request) *Protocol {
+	requested := websocket.Subprotocols(r)
+	if len(requested) == 0 {
+		return defaultProtocol
+	}
+
+	for _, p := range protocols {
+		for _, name := range requested {
+			if name == p.Name {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+func rejectProtocol(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "Unsupported protocol "+strings.Join(websocket.Subprotocols(r), ", ")+
+		"; supported: "+strings.Join(protocolNames(), ", "), http.StatusBadRequest)
+}
+
+// v1: events are sent exactly as published
+type jsonV1Codec struct{}
+
+func (jsonV1Codec) MessageType() int                    { return websocket.TextMessage }
+func (jsonV1Codec) Encode(event []byte) ([]byte, error) { return event, nil }
+func (jsonV1Codec) Decode(frame []byte) ([]byte, error) { return frame, nil }
+
+// v2: timestamps are unix milliseconds and routing fields are stripped
+type jsonV2Codec struct{}
+
+func (jsonV2Codec) MessageType() int                    { return websocket.TextMessage }
+func (jsonV2Codec) Decode(frame []byte) ([]byte, error) { return frame, nil }
+
+func (jsonV2Codec) Encode(event []byte) ([]byte, error) {
+	envelope, err := decodeEnvelope(event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope)
+}
+
+// decodeEnvelope parses a JSON event into the v2 envelope shape
+func decodeEnvelope(event []byte) (map[string]interface{}, error) {
+	var envelope map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(event))
+	decoder.UseNumber()
+	if err := decoder.Decode(&envelope); err != nil {
+		return nil, err
+	}
+
+	if ts, ok := envelope["timestamp"].(json.Number); ok {
+		if seconds, err := ts.Int64(); err == nil {
+			envelope["timestamp"] = toMillis(seconds)
+		}
+	}
+	delete(envelope, "excludeConnectionId")
+	delete(envelope, "excludeUserId")
+
+	return envelope, nil
+}
+
+// toMillis converts a published timestamp to unix milliseconds. Publishers
+// send seconds; anything that large is already milliseconds.
+func toMillis(ts int64) int64 {
+	if ts < 1e11 {
+		return ts * 1000
+	}
+	return ts
+}
+
+// frameCache encodes each payload of a fan-out once per protocol, as a
+// prepared message shared by all recipients. The prepared message also caches
+// its WebSocket frame per compression setting, so framing and compression run
+// once per fan-out rather than once per connection.
+type frameCache map[frameKey]outbound
+
+type frameKey struct {
+	protocol *Protocol
+	payload  *byte
+}
+
+func (fc frameCache) prepare(p *Protocol, payload []byte) (outbound, error) {
+	if len(payload) == 0 {
+		return outbound{}, errors.New("empty payload")
+	}
+
+	key := frameKey{protocol: p, payload: &payload[0]}
+	if frame, ok := fc[key]; ok {
+		return frame, nil
+	}
+
+	data, err := p.Codec.Encode(payload)
+	if err != nil {
+		return outbound{}, err
+	}
+
+	prepared, err := websocket.NewPreparedMessage(p.Codec.MessageType(), data)
+	if err != nil {
+		return outbound{}, err
+	}
+
+	frame := outbound{data: data, prepared: prepared}
+	fc[key] = frame
+	return frame, nil
+}
@@ -0,0 +1,111 @@
+package ws
+
+import (
+	"go-websocket/internal/ratelimit"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type RateLimitAction string
+
+const (
+	// Drop rate limited events silently
+	RateLimitDrop RateLimitAction = "drop"
+
+	// Reply to rate limited events with a rate_limited error frame
+	RateLimitError RateLimitAction = "error"
+
+	// Reply with an error frame and close the connection after CloseAfter violations
+	RateLimitClose RateLimitAction = "close"
+)
+
+// Window in which violations are counted towards CloseAfter
+const violationWindow = time.Minute
+
+type RateLimitOptions struct {
+	// Limits applied to each connection on its own
+	ConnRules ratelimit.Rules
+
+	// Limits shared by all connections of a user, across every node
+	UserRules ratelimit.Rules
+
+	Action     RateLimitAction
+	CloseAfter int
+}
+
+// clientLimiter tracks the per-connection buckets and violations of a client.
+// It is only used by the connection's reader and needs no locking.
+type clientLimiter struct {
+	buckets     map[string]*ratelimit.Bucket
+	violations  int
+	windowStart time.Time
+}
+
+func newClientLimiter() *clientLimiter {
+	return &clientLimiter{
+		buckets: make(map[string]*ratelimit.Bucket),
+	}
+}
+
+// rateLimit is the hub-wide middleware applying the connection and user
+// rate limits to every client event
+func (h *Hub) rateLimit(next HandlerFunc) HandlerFunc {
+	return func(c *Client, req *Request) (interface{}, error) {
+		if c.allowConn(req.Type) && c.allowUser(req.Type) {
+			return next(c, req)
+		}
+
+		slog.Warn("[CLIENT] Rate limited", "type", req.Type, "user", c.userId, "channel", c.channelId)
+
+		opts := h.opts.RateLimit
+		switch opts.Action {
+		case RateLimitDrop:
+			return nil, ErrDrop
+
+		case RateLimitClose:
+			now := time.Now()
+			if now.Sub(c.limiter.windowStart) > violationWindow {
+				c.limiter.windowStart = now
+				c.limiter.violations = 0
+			}
+			c.limiter.violations++
+
+			if opts.CloseAfter > 0 && c.limiter.violations >= opts.CloseAfter {
+				slog.Warn("[CLIENT] Closing connection after repeated rate limit violations", "user", c.userId, "channel", c.channelId, "violations", c.limiter.violations)
+				return nil, &CloseError{Code: websocket.ClosePolicyViolation, Text: "rate limit exceeded"}
+			}
+		}
+
+		return nil, &Error{Code: ErrCodeRateLimited, Message: "Too many '" + req.Type + "' events"}
+	}
+}
+
+func (c *Client) allowConn(eventType string) bool {
+	key, rule, ok := c.hub.opts.RateLimit.ConnRules.Lookup(eventType)
+	if !ok {
+		return true
+	}
+
+	b, ok := c.limiter.buckets[key]
+	if !ok {
+		b = ratelimit.NewBucket(rule)
+		c.limiter.buckets[key] = b
+	}
+	return b.Allow()
+}
+
+func (c *Client) allowUser(eventType string) bool {
+	key, rule, ok := c.hub.opts.RateLimit.UserRules.Lookup(eventType)
+	if !ok {
+		return true
+	}
+
+	allowed, err := c.hub.redisClient.AllowRate(c.userId+":"+key, rule.Limit, rule.Period)
+	if err != nil {
+		// Fail open: a Redis hiccup shouldn't block every client
+		return true
+	}
+	return allowed
+}
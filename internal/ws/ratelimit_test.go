@@ -0,0 +1,157 @@
+package ws
+
+import (
+	"errors"
+	"go-websocket/internal/ratelimit"
+	"go-websocket/internal/ws/wstest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// ratePublisher records the keys of user rate limits and allows them while
+// allow is set
+type ratePublisher struct {
+	wstest.NopPublisher
+	keys  []string
+	allow bool
+}
+
+func (p *ratePublisher) AllowRate(key string, limit int, period time.Duration) (bool, error) {
+	p.keys = append(p.keys, key)
+	return p.allow, nil
+}
+
+func TestRateLimit(t *testing.T) {
+	rules, err := ratelimit.ParseRules("typing:start=2/1m,client:*=2/1m,*=2/1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		action RateLimitAction
+		// Event types sent in order
+		types []string
+
+		// Outcome of each: "ok", "drop", "error" or "close"
+		want    []string
+		buckets []string
+	}{
+		{
+			name:    "error once the bucket is empty",
+			action:  RateLimitError,
+			types:   []string{"typing:start", "typing:start", "typing:start"},
+			want:    []string{"ok", "ok", "error"},
+			buckets: []string{"typing:start"},
+		},
+		{
+			name:    "drop",
+			action:  RateLimitDrop,
+			types:   []string{"typing:start", "typing:start", "typing:start"},
+			want:    []string{"ok", "ok", "drop"},
+			buckets: []string{"typing:start"},
+		},
+		{
+			name:    "close after repeated violations",
+			action:  RateLimitClose,
+			types:   []string{"typing:start", "typing:start", "typing:start", "typing:start"},
+			want:    []string{"ok", "ok", "error", "close"},
+			buckets: []string{"typing:start"},
+		},
+		{
+			name:    "namespace types share a bucket",
+			action:  RateLimitError,
+			types:   []string{"client:cursor", "client:viewing", "client:other"},
+			want:    []string{"ok", "ok", "error"},
+			buckets: []string{"client:*"},
+		},
+		{
+			name:    "wildcard types share a bucket",
+			action:  RateLimitError,
+			types:   []string{"made:up:1", "made:up:2", "made:up:3", "made:up:4"},
+			want:    []string{"ok", "ok", "error", "error"},
+			buckets: []string{"*"},
+		},
+		{
+			name:    "buckets are independent",
+			action:  RateLimitError,
+			types:   []string{"typing:start", "typing:start", "client:cursor", "ping", "typing:start"},
+			want:    []string{"ok", "ok", "ok", "ok", "error"},
+			buckets: []string{"*", "client:*", "typing:start"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub(&ratePublisher{allow: true}, Options{RateLimit: RateLimitOptions{
+				ConnRules:  rules,
+				Action:     tt.action,
+				CloseAfter: 2,
+			}})
+			client, _ := newDiscardClient(t, hub, "channel_test", false)
+			handler := hub.rateLimit(func(c *Client, req *Request) (interface{}, error) {
+				return nil, nil
+			})
+
+			var got []string
+			for _, eventType := range tt.types {
+				_, err := handler(client, &Request{Type: eventType})
+				got = append(got, outcome(err))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("outcomes = %v, want %v", got, tt.want)
+			}
+
+			var buckets []string
+			for key := range client.limiter.buckets {
+				buckets = append(buckets, key)
+			}
+			slices.Sort(buckets)
+			if !slices.Equal(buckets, tt.buckets) {
+				t.Errorf("buckets = %v, want %v", buckets, tt.buckets)
+			}
+		})
+	}
+}
+
+func outcome(err error) string {
+	var closeErr *CloseError
+	var rateErr *Error
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrDrop):
+		return "drop"
+	case errors.As(err, &closeErr):
+		return "close"
+	case errors.As(err, &rateErr) && rateErr.Code == ErrCodeRateLimited:
+		return "error"
+	}
+	return err.Error()
+}
+
+func TestRateLimitUserKeys(t *testing.T) {
+	rules, err := ratelimit.ParseRules("typing:start=10/1s,client:*=10/1s,*=10/1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher := &ratePublisher{}
+	hub := NewHub(publisher, Options{RateLimit: RateLimitOptions{UserRules: rules, Action: RateLimitError}})
+	client, _ := newDiscardClient(t, hub, "channel_test", false)
+	handler := hub.rateLimit(func(c *Client, req *Request) (interface{}, error) {
+		return nil, nil
+	})
+
+	for _, eventType := range []string{"typing:start", "client:cursor", "made:up:1", "made:up:2"} {
+		if _, err := handler(client, &Request{Type: eventType}); outcome(err) != "error" {
+			t.Errorf("%s: got %v, want a rate_limited error", eventType, err)
+		}
+	}
+
+	u := client.userId
+	want := []string{u + ":typing:start", u + ":client:*", u + ":*", u + ":*"}
+	if !slices.Equal(publisher.keys, want) {
+		t.Errorf("keys = %v, want %v", publisher.keys, want)
+	}
+}
@@ -0,0 +1,93 @@
+package ws
+
+import (
+	"go-websocket/internal/models"
+	"log/slog"
+	"time"
+)
+
+type ReceiptOptions struct {
+	// Deliver read:updated only to the author of the read message instead
+	// of the whole channel
+	AuthorOnly bool
+}
+
+type readMarkRequest struct {
+	MessageId string `json:"messageId"`
+	ThreadId  string `json:"threadId,omitempty"`
+}
+
+func (r *readMarkRequest) Validate() error {
+	if r.MessageId == "" || len(r.MessageId) > 128 {
+		return &Error{Code: ErrCodeInvalidPayload, Message: "Invalid messageId"}
+	}
+	if len(r.ThreadId) > maxThreadIdLength {
+		return &Error{Code: ErrCodeInvalidPayload, Message: "Invalid threadId"}
+	}
+	return nil
+}
+
+func (h *Hub) registerReceiptHandlers() {
+	h.Handle("read:mark", Typed(h.handleReadMark), WithSchema(&Schema{
+		MaxSize:  512,
+		Required: []string{"messageId"},
+		Fields:   map[string]FieldType{"messageId": FieldString, "threadId": FieldString},
+	}))
+	h.Handle("unread:get", h.handleUnreadGet)
+}
+
+// handleReadMark moves the user's read cursor, broadcasts the receipt and
+// syncs the cleared unread count to the user's other connections. Only
+// messages known to belong to the connection's channel can be marked read.
+func (h *Hub) handleReadMark(c *Client, req *Request, data *readMarkRequest) (interface{}, error) {
+	channelId, authorId, err := h.redisClient.GetMessage(data.MessageId)
+	if err != nil {
+		slog.Error("[CLIENT] Failed to look up message", "message", data.MessageId, "error", err)
+		return nil, &Error{Code: ErrCodeInternal, Message: "Failed to look up message"}
+	}
+	if channelId != c.channelId {
+		slog.Warn("[CLIENT] read:mark for a message of another channel", "user", c.userId, "channel", c.channelId, "message", data.MessageId, "messageChannel", channelId)
+		return nil, &Error{Code: ErrCodeInvalidPayload, Message: "Unknown messageId"}
+	}
+
+	if err := h.redisClient.SetReadCursor(c.channelId, c.userId, data.MessageId); err != nil {
+		return nil, &Error{Code: ErrCodePublishFailed, Message: "Failed to store read cursor"}
+	}
+
+	receipt := &models.ReadReceiptData{
+		UserId:    c.userId,
+		MessageId: data.MessageId,
+		ThreadId:  data.ThreadId,
+		ReadAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+
+	toUserId, sendReceipt := "", true
+	if h.opts.Receipts.AuthorOnly {
+		// No receipt for the author reading their own message, but the
+		// count was still reset
+		toUserId, sendReceipt = authorId, authorId != "" && authorId != c.userId
+	}
+
+	if sendReceipt {
+		if err := h.redisClient.PublishReadUpdated(c.channelId, receipt, toUserId); err != nil {
+			return nil, &Error{Code: ErrCodePublishFailed, Message: "Failed to publish 'read:updated'"}
+		}
+	}
+
+	if err := h.redisClient.PublishUnreadUpdated(c.userId, c.channelId, 0); err != nil {
+		slog.Error("[CLIENT] Failed to publish unread:updated", "user", c.userId, "channel", c.channelId, "error", err)
+	}
+
+	return nil, nil
+}
+
+// handleUnreadGet returns the user's unread count per channel
+func (h *Hub) handleUnreadGet(c *Client, req *Request) (interface{}, error) {
+	counts, err := h.redisClient.GetUnreadCounts(c.userId)
+	if err != nil {
+		slog.Error("[CLIENT] Failed to get unread counts", "user", c.userId, "error", err)
+		return nil, &Error{Code: ErrCodeInternal, Message: "Failed to get unread counts"}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,126 @@
+package ws
+
+import (
+	"errors"
+	"go-websocket/internal/models"
+	"go-websocket/internal/ws/wstest"
+	"slices"
+	"testing"
+
+	"github.com/goccy/go-json"
+)
+
+// receiptPublisher knows the channel and author of a few messages and records
+// read cursors and receipts
+type receiptPublisher struct {
+	wstest.NopPublisher
+	cursors  []string
+	receipts []string
+}
+
+func (p *receiptPublisher) GetMessage(messageId string) (string, string, error) {
+	switch messageId {
+	case "msg_here":
+		return "channel_test", "user_author", nil
+	case "msg_own":
+		return "channel_test", "user_reader", nil
+	case "msg_elsewhere":
+		return "channel_other", "user_author", nil
+	case "msg_error":
+		return "", "", errors.New("redis down")
+	}
+	return "", "", nil
+}
+
+func (p *receiptPublisher) SetReadCursor(channelId, userId, messageId string) error {
+	p.cursors = append(p.cursors, channelId+":"+userId+":"+messageId)
+	return nil
+}
+
+func (p *receiptPublisher) PublishReadUpdated(channelId string, receipt *models.ReadReceiptData, toUserId string) error {
+	p.receipts = append(p.receipts, channelId+":"+receipt.MessageId+":"+toUserId)
+	return nil
+}
+
+func TestReadMark(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorOnly bool
+		messageId  string
+
+		// Error code, or "" if accepted
+		wantErr      string
+		wantCursor   string
+		wantReceipts []string
+	}{
+		{
+			name:         "message of the channel",
+			messageId:    "msg_here",
+			wantCursor:   "channel_test:user_reader:msg_here",
+			wantReceipts: []string{"channel_test:msg_here:"},
+		},
+		{
+			name:         "receipt to the author only",
+			authorOnly:   true,
+			messageId:    "msg_here",
+			wantCursor:   "channel_test:user_reader:msg_here",
+			wantReceipts: []string{"channel_test:msg_here:user_author"},
+		},
+		{
+			name:       "no receipt for the author's own message",
+			authorOnly: true,
+			messageId:  "msg_own",
+			wantCursor: "channel_test:user_reader:msg_own",
+		},
+		{
+			name:      "message of another channel",
+			messageId: "msg_elsewhere",
+			wantErr:   ErrCodeInvalidPayload,
+		},
+		{
+			name:      "unknown message",
+			messageId: "msg_made_up",
+			wantErr:   ErrCodeInvalidPayload,
+		},
+		{
+			name:      "lookup failure",
+			messageId: "msg_error",
+			wantErr:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &receiptPublisher{}
+			hub := NewHub(publisher, Options{Receipts: ReceiptOptions{AuthorOnly: tt.authorOnly}})
+			client, _ := newDiscardClient(t, hub, "channel_test", false)
+			client.userId = "user_reader"
+
+			handler, ok := hub.handler("read:mark")
+			if !ok {
+				t.Fatal("read:mark not registered")
+			}
+			data, _ := json.Marshal(map[string]string{"messageId": tt.messageId})
+			_, err := handler(client, &Request{Type: "read:mark", Data: data})
+
+			var reqErr *Error
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("read:mark failed: %v", err)
+			case tt.wantErr != "" && (!errors.As(err, &reqErr) || reqErr.Code != tt.wantErr):
+				t.Fatalf("read:mark = %v, want %s", err, tt.wantErr)
+			}
+
+			var wantCursors []string
+			if tt.wantCursor != "" {
+				wantCursors = []string{tt.wantCursor}
+			}
+			if !slices.Equal(publisher.cursors, wantCursors) {
+				t.Errorf("cursors = %v, want %v", publisher.cursors, wantCursors)
+			}
+			if !slices.Equal(publisher.receipts, tt.wantReceipts) {
+				t.Errorf("receipts = %v, want %v", publisher.receipts, tt.wantReceipts)
+			}
+		})
+	}
+}
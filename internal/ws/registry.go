@@ -0,0 +1,156 @@
+package ws
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+type route struct {
+	handler    HandlerFunc
+	schema     *Schema
+	middleware []Middleware
+
+	// handler wrapped in the hub-wide middleware, rebuilt by Use
+	chain HandlerFunc
+}
+
+type HandlerOption func(*route)
+
+// WithSchema validates the request data against schema before the handler runs
+func WithSchema(schema *Schema) HandlerOption {
+	return func(r *route) {
+		r.schema = schema
+	}
+}
+
+// WithMiddleware wraps only this handler, inside the hub-wide middleware
+func WithMiddleware(mw ...Middleware) HandlerOption {
+	return func(r *route) {
+		r.middleware = append(r.middleware, mw...)
+	}
+}
+
+// Handle registers the handler for a client event type, replacing any
+// existing one. A namespace pattern like "client:*" handles every type in
+// the namespace without a handler of its own. Handlers should be registered
+// before clients connect.
+func (h *Hub) Handle(eventType string, handler HandlerFunc, opts ...HandlerOption) {
+	r := &route{handler: handler}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	// Compose innermost first: schema validation, route middleware, handler
+	next := r.handler
+	if r.schema != nil {
+		next = r.schema.middleware(next)
+	}
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		next = r.middleware[i](next)
+	}
+	r.handler = next
+
+	h.handlersMu.Lock()
+	r.chain = h.chain(r.handler)
+	h.handlers[eventType] = r
+	h.handlersMu.Unlock()
+}
+
+// Use adds middleware that runs for every client event type
+func (h *Hub) Use(mw ...Middleware) {
+	h.handlersMu.Lock()
+	defer h.handlersMu.Unlock()
+
+	h.middleware = append(h.middleware, mw...)
+	for _, r := range h.handlers {
+		r.chain = h.chain(r.handler)
+	}
+}
+
+// chain wraps a handler in the hub-wide middleware; handlersMu must be held
+func (h *Hub) chain(next HandlerFunc) HandlerFunc {
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		next = h.middleware[i](next)
+	}
+	return next
+}
+
+// Schemas returns the schema of every handler registered with one
+func (h *Hub) Schemas() map[string]*Schema {
+	h.handlersMu.RLock()
+	defer h.handlersMu.RUnlock()
+
+	schemas := make(map[string]*Schema)
+	for eventType, r := range h.handlers {
+		if r.schema != nil {
+			schemas[eventType] = r.schema
+		}
+	}
+	return schemas
+}
+
+// handler returns the full middleware chain for an event type
+func (h *Hub) handler(eventType string) (HandlerFunc, bool) {
+	h.handlersMu.RLock()
+	defer h.handlersMu.RUnlock()
+
+	r, ok := h.handlers[eventType]
+	if !ok {
+		if r, ok = h.handlers[namespacePattern(eventType)]; !ok {
+			return nil, false
+		}
+	}
+
+	return r.chain, true
+}
+
+// namespacePattern returns the "ns:*" pattern matching an event type
+func namespacePattern(eventType string) string {
+	ns, _, ok := strings.Cut(eventType, ":")
+	if !ok {
+		return ""
+	}
+	return ns + ":*"
+}
+
+// Validator is implemented by typed payloads that check their own fields
+type Validator interface {
+	Validate() error
+}
+
+// Typed adapts a handler taking a decoded payload of type T. The request data
+// is unmarshaled into T and validated if T implements Validator.
+func Typed[T any](fn func(c *Client, req *Request, data *T) (interface{}, error)) HandlerFunc {
+	return func(c *Client, req *Request) (interface{}, error) {
+		data := new(T)
+		if len(req.Data) > 0 {
+			if err := json.Unmarshal(req.Data, data); err != nil {
+				return nil, &Error{Code: ErrCodeInvalidPayload, Message: "Invalid '" + req.Type + "' payload"}
+			}
+		}
+
+		if v, ok := any(data).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				if e, ok := err.(*Error); ok {
+					return nil, e
+				}
+				return nil, &Error{Code: ErrCodeInvalidPayload, Message: err.Error()}
+			}
+		}
+
+		return fn(c, req, data)
+	}
+}
+
+// LoggingMiddleware logs every request with its outcome and duration
+func LoggingMiddleware(next HandlerFunc) HandlerFunc {
+	return func(c *Client, req *Request) (interface{}, error) {
+		start := time.Now()
+		result, err := next(c, req)
+		slog.Debug("[CLIENT] Handled request", "type", req.Type, "id", req.Id, "user", c.userId, "channel", c.channelId, "duration", time.Since(start), "error", err)
+		return result, err
+	}
+}
@@ -0,0 +1,113 @@
+package ws
+
+import (
+	"go-websocket/internal/models"
+	"log/slog"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const defaultReplayMaxEvents = 100
+
+type ReplayOptions struct {
+	// Events sent per replay request at most; 100 if 0
+	MaxEvents int
+}
+
+type replayRequest struct {
+	FromSeq int64 `json:"fromSeq"`
+	ToSeq   int64 `json:"toSeq,omitempty"`
+}
+
+func (r *replayRequest) Validate() error {
+	if r.FromSeq < 1 || (r.ToSeq != 0 && r.ToSeq < r.FromSeq) {
+		return &Error{Code: ErrCodeInvalidPayload, Message: "Invalid sequence range"}
+	}
+	return nil
+}
+
+// replayResult is acked once the replayed events are queued. FromSeq and
+// ToSeq are the range of history covered, including events this client
+// doesn't get, which are sent as seq:skip and left out of Count; a FromSeq
+// above the requested one means older events are no longer kept. More is set
+// if the client should ask again from ToSeq+1.
+type replayResult struct {
+	FromSeq int64 `json:"fromSeq"`
+	ToSeq   int64 `json:"toSeq"`
+	Count   int   `json:"count"`
+	More    bool  `json:"more"`
+}
+
+func (h *Hub) registerReplayHandlers() {
+	h.Handle("replay", Typed(h.handleReplay), WithSchema(&Schema{
+		MaxSize:  256,
+		Required: []string{"fromSeq"},
+		Fields:   map[string]FieldType{"fromSeq": FieldNumber, "toSeq": FieldNumber},
+	}))
+}
+
+// handleReplay resends the events of the client's channel in a sequence
+// range, in order, from the channel history kept in Redis
+func (h *Hub) handleReplay(c *Client, req *Request, data *replayRequest) (interface{}, error) {
+	limit := h.opts.Replay.MaxEvents
+	if limit <= 0 {
+		limit = defaultReplayMaxEvents
+	}
+
+	// One more than sent tells whether the range has more events
+	messages, err := h.redisClient.GetHistory(c.channelId, data.FromSeq, data.ToSeq, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &replayResult{}
+	for i, message := range messages {
+		if i == limit {
+			result.More = true
+			break
+		}
+
+		payload, p := c.payload(message), eventPriority(message.Type)
+		skipped := payload == nil
+		if skipped {
+			payload, p = skipPayload(message), priorityLow
+		}
+
+		frame, err := c.protocol.Codec.Encode(payload)
+		if err != nil {
+			slog.Error("[CLIENT] Failed to encode event", "protocol", c.protocol.Name, "user", c.userId, "channel", c.channelId, "error", err)
+			continue
+		}
+
+		// Stop at a full queue; the client asks again for the rest
+		pushed := c.send.push(outbound{data: frame, priority: p}, BackpressureDropNewest)
+		if pushed == pushDroppedNew || pushed == pushOverflow {
+			result.More = true
+			break
+		}
+		if !skipped {
+			result.Count++
+		}
+
+		if result.FromSeq == 0 {
+			result.FromSeq = message.Seq
+		}
+		result.ToSeq = message.Seq
+	}
+
+	return result, nil
+}
+
+// skipPayload is the seq:skip event sent instead of a numbered event a client
+// doesn't get, e.g. its own message or a reply in a thread it isn't viewing,
+// so that the numbers it sees have no gaps
+func skipPayload(message *models.BroadcastMessage) []byte {
+	payload, _ := json.Marshal(models.Event{
+		Type:      models.EventSeqSkip,
+		ChannelId: message.ChannelId,
+		Timestamp: time.Now().Unix(),
+		Seq:       message.Seq,
+	})
+	return payload
+}
@@ -0,0 +1,101 @@
+package ws
+
+import (
+	"fmt"
+
+	"github.com/goccy/go-json"
+)
+
+type FieldType string
+
+const (
+	FieldString  FieldType = "string"
+	FieldNumber  FieldType = "number"
+	FieldBoolean FieldType = "boolean"
+	FieldObject  FieldType = "object"
+	FieldArray   FieldType = "array"
+)
+
+// Schema describes the data payload accepted by a handler
+type Schema struct {
+	// Maximum size of the raw data in bytes, 0 means no limit
+	MaxSize int `json:"maxSize,omitempty"`
+
+	// Fields that must be present
+	Required []string `json:"required,omitempty"`
+
+	// Expected JSON type of each known field
+	Fields map[string]FieldType `json:"fields,omitempty"`
+
+	// Reject fields not listed in Fields
+	Strict bool `json:"strict,omitempty"`
+}
+
+// Validate checks raw request data against the schema
+func (s *Schema) Validate(data json.RawMessage) error {
+	if s.MaxSize > 0 && len(data) > s.MaxSize {
+		return &Error{Code: ErrCodeInvalidPayload, Message: fmt.Sprintf("Payload exceeds %d bytes", s.MaxSize)}
+	}
+
+	fields := map[string]json.RawMessage{}
+	if len(data) > 0 && string(data) != "null" {
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return &Error{Code: ErrCodeInvalidPayload, Message: "Payload must be an object"}
+		}
+	}
+
+	for _, name := range s.Required {
+		if value, ok := fields[name]; !ok || jsonType(value) == "" {
+			return &Error{Code: ErrCodeInvalidPayload, Message: "Missing field '" + name + "'"}
+		}
+	}
+
+	for name, value := range fields {
+		expected, ok := s.Fields[name]
+		if !ok {
+			if s.Strict {
+				return &Error{Code: ErrCodeInvalidPayload, Message: "Unknown field '" + name + "'"}
+			}
+			continue
+		}
+
+		// null is accepted for any optional field
+		if actual := jsonType(value); actual != "" && actual != expected {
+			return &Error{Code: ErrCodeInvalidPayload, Message: fmt.Sprintf("Field '%s' must be a %s", name, expected)}
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) middleware(next HandlerFunc) HandlerFunc {
+	return func(c *Client, req *Request) (interface{}, error) {
+		if err := s.Validate(req.Data); err != nil {
+			return nil, err
+		}
+		return next(c, req)
+	}
+}
+
+// jsonType returns the schema type of a raw JSON value
+func jsonType(value json.RawMessage) FieldType {
+	for _, b := range value {
+		switch b {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '"':
+			return FieldString
+		case '{':
+			return FieldObject
+		case '[':
+			return FieldArray
+		case 't', 'f':
+			return FieldBoolean
+		case 'n':
+			return ""
+		default:
+			return FieldNumber
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package ws
+
+import "fmt"
+
+// Maximum number of threads a connection can subscribe to at once
+const maxThreadsPerClient = 50
+
+type threadRequest struct {
+	ThreadId string `json:"threadId"`
+}
+
+func (r *threadRequest) Validate() error {
+	if r.ThreadId == "" || len(r.ThreadId) > maxThreadIdLength {
+		return &Error{Code: ErrCodeInvalidPayload, Message: "Invalid threadId"}
+	}
+	return nil
+}
+
+func (h *Hub) registerThreadHandlers() {
+	threadSchema := &Schema{
+		MaxSize:  512,
+		Required: []string{"threadId"},
+		Fields:   map[string]FieldType{"threadId": FieldString},
+	}
+	h.Handle("thread:subscribe", Typed(handleThreadSubscribe), WithSchema(threadSchema))
+	h.Handle("thread:unsubscribe", Typed(handleThreadUnsubscribe), WithSchema(threadSchema))
+}
+
+func handleThreadSubscribe(c *Client, req *Request, data *threadRequest) (interface{}, error) {
+	c.threadsMu.Lock()
+	defer c.threadsMu.Unlock()
+
+	if c.threads == nil {
+		c.threads = make(map[string]bool)
+	}
+	if !c.threads[data.ThreadId] && len(c.threads) >= maxThreadsPerClient {
+		return nil, &Error{Code: ErrCodeInvalidPayload, Message: fmt.Sprintf("Cannot subscribe to more than %d threads", maxThreadsPerClient)}
+	}
+	c.threads[data.ThreadId] = true
+
+	return nil, nil
+}
+
+func handleThreadUnsubscribe(c *Client, req *Request, data *threadRequest) (interface{}, error) {
+	c.threadsMu.Lock()
+	defer c.threadsMu.Unlock()
+
+	delete(c.threads, data.ThreadId)
+	return nil, nil
+}
+
+func (c *Client) inThread(threadId string) bool {
+	c.threadsMu.RLock()
+	defer c.threadsMu.RUnlock()
+
+	return c.threads[threadId]
+}
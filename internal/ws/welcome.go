@@ -0,0 +1,41 @@
+package ws
+
+import (
+	"go-websocket/internal/models"
+	"go-websocket/internal/ratelimit"
+)
+
+func rateLimitsOf(rules ratelimit.Rules) map[string]models.RateLimit {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	limits := make(map[string]models.RateLimit, len(rules))
+	for eventType, rule := range rules {
+		limits[eventType] = models.RateLimit{
+			Limit:    rule.Limit,
+			PeriodMs: rule.Period.Milliseconds(),
+		}
+	}
+	return limits
+}
+
+// sendWelcome tells a registered client about its connection and the limits
+// it must respect
+func (h *Hub) sendWelcome(client *Client) {
+	client.sendEvent(models.EventConnected, models.ConnectionData{
+		ConnectionId:        client.id,
+		NodeId:              h.opts.NodeId,
+		UserId:              client.userId,
+		Channels:            []string{client.channelId},
+		Protocol:            client.protocol.Name,
+		ProtocolVersion:     client.protocol.Version,
+		Compression:         client.compress,
+		HeartbeatIntervalMs: client.pingInterval().Milliseconds(),
+		Limits: models.ConnectionLimits{
+			MaxMessageSize: maxMessageSize,
+			RateLimits:     rateLimitsOf(h.opts.RateLimit.ConnRules),
+			UserRateLimits: rateLimitsOf(h.opts.RateLimit.UserRules),
+		},
+	})
+}
@@ -0,0 +1,37 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/internal/models"
+	"log/slog"
+)
+
+type WhisperOptions struct {
+	// Maximum size of a client:* event payload in bytes
+	MaxSize int
+}
+
+func (h *Hub) registerWhisperHandlers() {
+	h.Handle(models.WhisperNamespace+"*", h.handleWhisper)
+}
+
+// handleWhisper relays an ephemeral client:* event to the other connections
+// of the channel, tagged with the sender's verified identity
+func (h *Hub) handleWhisper(c *Client, req *Request) (interface{}, error) {
+	if max := h.opts.Whisper.MaxSize; max > 0 && len(req.Data) > max {
+		return nil, &Error{Code: ErrCodeInvalidPayload, Message: fmt.Sprintf("Payload exceeds %d bytes", max)}
+	}
+
+	whisper := &models.WhisperData{
+		UserId:   c.userId,
+		UserName: c.userName,
+		Payload:  req.Data,
+	}
+
+	if err := h.redisClient.PublishWhisper(c.channelId, req.Type, c.id, whisper); err != nil {
+		slog.Error("[CLIENT] Failed to publish whisper", "type", req.Type, "user", c.userId, "channel", c.channelId, "error", err)
+		return nil, &Error{Code: ErrCodePublishFailed, Message: "Failed to publish '" + req.Type + "'"}
+	}
+
+	return nil, nil
+}
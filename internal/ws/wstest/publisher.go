@@ -0,0 +1,38 @@
+// Package wstest provides stand-ins for the dependencies of the ws hub, for
+// tests and benchmarks that run without Redis.
+package wstest
+
+import (
+	"go-websocket/internal/models"
+	"time"
+)
+
+// NopPublisher implements ws.RedisPublisher without Redis: publishing does
+// nothing, lookups find nothing and every rate limit allows. Tests inject
+// events into the hub directly.
+type NopPublisher struct{}
+
+func (NopPublisher) PublishMessageCreated(channelId string, message interface{}) error { return nil }
+func (NopPublisher) PublishPresenceJoin(channelId, userId, userName string) error      { return nil }
+func (NopPublisher) PublishPresenceLeave(channelId, userId string) error               { return nil }
+func (NopPublisher) PublishTypingStart(channelId, userId, userName string, threadId *string) error {
+	return nil
+}
+func (NopPublisher) PublishTypingStop(channelId, userId string, threadId *string) error { return nil }
+func (NopPublisher) PublishWhisper(channelId, eventType, senderConnectionId string, whisper *models.WhisperData) error {
+	return nil
+}
+func (NopPublisher) PublishReadUpdated(channelId string, receipt *models.ReadReceiptData, toUserId string) error {
+	return nil
+}
+func (NopPublisher) PublishUnreadUpdated(userId, channelId string, count int64) error { return nil }
+func (NopPublisher) AddChannelMember(channelId, userId string) error                  { return nil }
+func (NopPublisher) SetReadCursor(channelId, userId, messageId string) error          { return nil }
+func (NopPublisher) GetMessage(messageId string) (string, string, error)              { return "", "", nil }
+func (NopPublisher) GetUnreadCounts(userId string) (map[string]int64, error)          { return nil, nil }
+func (NopPublisher) AllowRate(key string, limit int, period time.Duration) (bool, error) {
+	return true, nil
+}
+func (NopPublisher) GetHistory(channelId string, fromSeq, toSeq int64, limit int) ([]*models.BroadcastMessage, error) {
+	return nil, nil
+}
@@ -88,6 +88,57 @@ docker exec go-websocket-redis redis-cli PUBLISH "channel:$CHANNEL_ID" '{
   }
 }'
 
+echo ""
+sleep 1
+
+# Test 6: Message Updated Event
+echo "✏️  Test 6: Publishing message:updated event..."
+docker exec go-websocket-redis redis-cli PUBLISH "channel:$CHANNEL_ID" '{
+  "type": "message:updated",
+  "channelId": "'$CHANNEL_ID'",
+  "timestamp": '$(date +%s)',
+  "data": {
+    "id": "msg_123",
+    "content": "Hello from Redis test! (edited)",
+    "editedBy": "user_test",
+    "updatedAt": "'$(date -u +"%Y-%m-%dT%H:%M:%SZ")'"
+  }
+}'
+
+echo ""
+sleep 1
+
+# Test 7: Reaction Added Event
+echo "👍 Test 7: Publishing reaction:added event..."
+docker exec go-websocket-redis redis-cli PUBLISH "channel:$CHANNEL_ID" '{
+  "type": "reaction:added",
+  "channelId": "'$CHANNEL_ID'",
+  "timestamp": '$(date +%s)',
+  "data": {
+    "messageId": "msg_123",
+    "emoji": "👍",
+    "userId": "user_test",
+    "reactions": [{ "emoji": "👍", "count": 1 }]
+  }
+}'
+
+echo ""
+sleep 1
+
+# Test 8: Message Deleted Event
+echo "🗑️  Test 8: Publishing message:deleted event..."
+docker exec go-websocket-redis redis-cli PUBLISH "channel:$CHANNEL_ID" '{
+  "type": "message:deleted",
+  "channelId": "'$CHANNEL_ID'",
+  "timestamp": '$(date +%s)',
+  "data": {
+    "id": "msg_123",
+    "hard": false,
+    "deletedBy": "user_test",
+    "deletedAt": "'$(date -u +"%Y-%m-%dT%H:%M:%SZ")'"
+  }
+}'
+
 echo ""
 echo "✅ All test messages published!"
 echo ""